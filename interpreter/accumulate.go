@@ -0,0 +1,146 @@
+package interpreter
+
+// Accumulate reescreve recursões lineares como um loop. Uma função
+//
+//	let f = fn (x, y) => if (c) { base } else { e + f(a, b) }
+//
+// em que f aparece uma única vez no corpo, como o lado direito de um + ou
+// *, vira um nó Loop: a cada volta avalia c, e, a e b, nessa ordem (a
+// mesma da recursão), e troca os parâmetros pelos novos argumentos, sem
+// empilhar chamadas. No fim, os valores de e são combinados com base.
+//
+// Quando a combinação é associativa (inteiros fora do modo i64-checked, ou
+// strings concatenadas), o loop usa um acumulador. Se um valor de outro
+// tipo aparece, o loop recomeça guardando cada e para combiná-los da
+// direita para a esquerda, exatamente como a recursão; isso só é feito se
+// a função não tem efeitos, então repetir a avaliação não é visível.
+// Funções com efeitos sempre usam essa segunda forma.
+//
+// Deve rodar depois de AnalyzeEffects.
+func Accumulate(ast map[string]interface{}) map[string]interface{} {
+	if ast["expression"] == nil {
+		return accumulateTerm(ast)
+	}
+	return with(ast, "expression", accumulateTerm(ast["expression"].(map[string]interface{})))
+}
+
+func accumulateTerm(term map[string]interface{}) map[string]interface{} {
+	child := func(key string) map[string]interface{} {
+		return accumulateTerm(term[key].(map[string]interface{}))
+	}
+
+	switch term["kind"] {
+	case "Let":
+		value := child("value")
+		if value["kind"] == "Function" {
+			if loop := linearLoop(term["name"].(map[string]interface{})["text"].(string), value); loop != nil {
+				value = with(value, "value", loop)
+			}
+		}
+		return with(with(term, "value", value), "next", child("next"))
+
+	case "Function", "First", "Second", "Unary", "Print":
+		return with(term, "value", child("value"))
+
+	case "Call":
+		args := make([]interface{}, len(term["arguments"].([]interface{})))
+		for i, a := range term["arguments"].([]interface{}) {
+			args[i] = accumulateTerm(a.(map[string]interface{}))
+		}
+		return with(with(term, "callee", child("callee")), "arguments", args)
+
+	case "If":
+		return with(with(with(term, "condition", child("condition")), "then", child("then")), "otherwise", child("otherwise"))
+
+	case "Tuple":
+		return with(with(term, "first", child("first")), "second", child("second"))
+
+	case "Binary":
+		return with(with(term, "lhs", child("lhs")), "rhs", child("rhs"))
+	}
+	return term
+}
+
+// linearLoop monta o nó Loop para o corpo de fn, ou nil se o corpo não é
+// uma recursão linear de name
+func linearLoop(name string, fn map[string]interface{}) map[string]interface{} {
+	params := fn["parameters"].([]interface{})
+	for _, p := range params {
+		if p.(map[string]interface{})["text"] == name {
+			return nil
+		}
+	}
+	// @memo forçado numa função com efeito pula os efeitos das chamadas
+	// que acertam a cache, o que o loop não reproduz
+	directive, _ := fn["memo"].(map[string]interface{})
+	if directive["enabled"] == true && fn["effect"].(*FunctionEffect).Effect == EffectEffectful {
+		return nil
+	}
+	body := fn["value"].(map[string]interface{})
+	if body["kind"] != "If" {
+		return nil
+	}
+	for _, branch := range []string{"then", "otherwise"} {
+		step := body[branch].(map[string]interface{})
+		if step["kind"] != "Binary" || (step["op"] != "Add" && step["op"] != "Mul") {
+			continue
+		}
+		call := step["rhs"].(map[string]interface{})
+		if call["kind"] != "Call" || call["callee"].(map[string]interface{})["kind"] != "Var" ||
+			call["callee"].(map[string]interface{})["text"] != name {
+			continue
+		}
+		args := call["arguments"].([]interface{})
+		base := body["then"].(map[string]interface{})
+		if branch == "then" {
+			base = body["otherwise"].(map[string]interface{})
+		}
+		parts := append([]interface{}{body["condition"], step["lhs"], base}, args...)
+		if len(args) != len(params) || mentions(parts, name) {
+			return nil
+		}
+
+		// o if e o operador continuam sendo nós da AST, para que erros
+		// apontem para o mesmo trecho do código
+		bools := func(v bool) map[string]interface{} {
+			return map[string]interface{}{"kind": "Bool", "value": v, "location": body["location"]}
+		}
+		slot := func(text string) map[string]interface{} {
+			return map[string]interface{}{"kind": "Var", "text": text, "location": step["location"]}
+		}
+		return map[string]interface{}{
+			"kind":      "Loop",
+			"location":  body["location"],
+			"condition": with(with(body, "then", bools(branch == "then")), "otherwise", bools(branch != "then")),
+			"element":   step["lhs"],
+			"arguments": args,
+			"base":      base,
+			"op":        step["op"],
+			"combine":   with(with(step, "lhs", slot("#element")), "rhs", slot("#rest")),
+			"effect":    fn["effect"],
+		}
+	}
+	return nil
+}
+
+// mentions indica se name aparece em algum dos termos, mesmo sombreado
+func mentions(terms []interface{}, name string) bool {
+	for _, t := range terms {
+		switch v := t.(type) {
+		case map[string]interface{}:
+			if v["kind"] == "Var" && v["text"] == name {
+				return true
+			}
+			for key, child := range v {
+				if key != "location" && key != "effect" && mentions([]interface{}{child}, name) {
+					return true
+				}
+			}
+		case []interface{}:
+			if mentions(v, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
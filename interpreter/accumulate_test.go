@@ -0,0 +1,92 @@
+package interpreter
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loops retorna os nomes das funções reescritas por Accumulate
+func loops(t *testing.T, src string) []string {
+	t.Helper()
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for let := Accumulate(AnalyzeEffects(ast))["expression"].(map[string]interface{}); let["kind"] == "Let"; let = let["next"].(map[string]interface{}) {
+		if field(let, "value", "value")["kind"] == "Loop" {
+			names = append(names, let["name"].(map[string]interface{})["text"].(string))
+		}
+	}
+	return names
+}
+
+func TestAccumulateDetection(t *testing.T) {
+	src := `
+let sum = fn (n) => if (n == 0) { 0 } else { n + sum(n - 1) };
+let prod = fn (n, k) => if (n > 0) { k * prod(n - 1, k) } else { 1 };
+let fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };
+let left = fn (n) => if (n == 0) { 0 } else { left(n - 1) + n };
+let sub = fn (n) => if (n == 0) { 0 } else { n - sub(n - 1) };
+let twice = fn (n) => if (n == 0) { 0 } else { twice(n - 1) + twice(n - 1) };
+let arity = fn (n) => if (n == 0) { 0 } else { n + arity(n - 1, 2) };
+let shadow = fn (shadow) => if (shadow == 0) { 0 } else { 1 + shadow(shadow - 1) };
+let inner = fn (n) => if (n == 0) { 0 } else { (fn (x) => inner(x))(n) + inner(n - 1) };
+let tail = fn (n, acc) => if (n == 0) { acc } else { tail(n - 1, acc + n) };
+// @memo
+let forced = fn (n) => if (n == 0) { print(0) } else { n + forced(n - 1) };
+let effects = fn (n) => if (n == 0) { print(0) } else { n + effects(n - 1) };
+0`
+	got := strings.Join(loops(t, src), " ")
+	if want := "sum prod effects"; got != want {
+		t.Errorf("rewritten: %s, want %s", got, want)
+	}
+}
+
+func TestAccumulate(t *testing.T) {
+	floats := 0.1
+	for i := 0; i < 10; i++ {
+		floats = 0.1 + floats
+	}
+	tests := []struct{ src, want string }{
+		{`let sum = fn (n) => if (n == 0) { 0 } else { n + sum(n - 1) }; sum(1000000)`, "500000500000"},
+		{`let f = fn (n) => if (n == 0) { 1 } else { n * f(n - 1) }; f(25)`, "15511210043330985984000000"},
+		{`let f = fn (n) => if (n == 0) { 7 } else { n * f(n - 1) }; f(0)`, "7"},
+		{`let s = fn (n) => if (n == 0) { "!" } else { "ab" + s(n - 1) }; s(3)`, "ababab!"},
+		{`let s = fn (n) => if (n == 0) { 1.5 } else { "a" + s(n - 1) }; s(2)`, "aa1.5"},
+		// a ordem da combinação importa: recomeça guardando os valores
+		{`let m = fn (n) => if (n == 0) { "x" } else { n + m(n - 1) }; m(3)`, "321x"},
+		{`let m = fn (n) => if (n == 0) { 0 } else { (if (n == 2) { "a" } else { n }) + m(n - 1) }; m(3)`, "3a1"},
+		{`let g = fn (n) => if (n == 0) { 0.1 } else { 0.1 + g(n - 1) }; g(10)`, formatFloat(floats)},
+		// closures capturadas e parâmetros trocados a cada volta
+		{`let k = 10; let f = fn (a, b) => if (a == 0) { b } else { (a * k) + f(b, a - 1) }; f(3, 4)`, "151"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestAccumulateEffects(t *testing.T) {
+	// cada volta avalia a condição, o elemento e os argumentos nessa ordem
+	src := `let f = fn (n) => if ((let _ = print("c" + n); n == 0)) { let _ = print("base"); 0 } else { (let _ = print("e" + n); n) + f((let _ = print("a" + n); n - 1)) }; f(2)`
+	ast, _ := Parse("test.rinha", src)
+	var out strings.Builder
+	if got := BuildAst(src, ast, Options{Output: &out})(); got.String() != "3" {
+		t.Errorf("f(2) = %s", got)
+	}
+	if want := "c2\ne2\na2\nc1\ne1\na1\nc0\nbase\n"; out.String() != want {
+		t.Errorf("output %q, want %q", out.String(), want)
+	}
+
+	// no modo i64-checked a soma parcial da esquerda estouraria, a da
+	// direita não
+	max := strconv.FormatInt(1<<63-1, 10)
+	src = `let f = fn (n) => if (n == 0) { -` + max + ` } else { ` + max + ` + f(n - 1) }; f(2)`
+	ast, _ = Parse("test.rinha", src)
+	if got := BuildAst(src, ast, Options{IntMode: IntModeI64Checked})(); got.String() != max {
+		t.Errorf("checked f(2) = %s", got)
+	}
+}
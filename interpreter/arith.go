@@ -0,0 +1,296 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// operações int64 com detecção exata de overflow
+
+func addInt64(l, r int64) (int64, bool) {
+	s := l + r
+	return s, (r >= 0) == (s >= l)
+}
+
+func subInt64(l, r int64) (int64, bool) {
+	d := l - r
+	return d, (r >= 0) == (d <= l)
+}
+
+func mulInt64(l, r int64) (int64, bool) {
+	if l == 0 || r == 0 {
+		return 0, true
+	}
+	p := l * r
+	if (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+		return p, false
+	}
+	return p, p/r == l
+}
+
+// divInt64 e remInt64 esperam r != 0
+func divInt64(l, r int64) (int64, bool) {
+	if l == math.MinInt64 && r == -1 {
+		return l, false
+	}
+	return l / r, true
+}
+
+func remInt64(l, r int64) int64 {
+	// MinInt64 % -1 é 0 em Go, sem overflow
+	return l % r
+}
+
+// operações entre valores inteiros (int64 ou bigint). Quando o resultado
+// não cabe em int64 ele é promovido para bigint.
+
+func addInts(l, r Value) Value {
+	if l.kind == KindInt && r.kind == KindInt {
+		if v, ok := addInt64(l.num, r.num); ok {
+			return Int(v)
+		}
+	}
+	return BigInt(new(big.Int).Add(l.toBig(), r.toBig()))
+}
+
+func subInts(l, r Value) Value {
+	if l.kind == KindInt && r.kind == KindInt {
+		if v, ok := subInt64(l.num, r.num); ok {
+			return Int(v)
+		}
+	}
+	return BigInt(new(big.Int).Sub(l.toBig(), r.toBig()))
+}
+
+func mulInts(l, r Value) Value {
+	if l.kind == KindInt && r.kind == KindInt {
+		if v, ok := mulInt64(l.num, r.num); ok {
+			return Int(v)
+		}
+	}
+	return BigInt(new(big.Int).Mul(l.toBig(), r.toBig()))
+}
+
+// Divisão inteira, igual para int64 e bigint:
+//   - o quociente é truncado em direção a zero: -7 / 2 == -3
+//   - o resto tem o sinal do dividendo: -7 % 2 == -1 e 7 % -2 == 1
+//   - a / b * b + a % b == a
+//   - dividir por zero é um erro, reportado pelo executor no local da operação
+
+var ErrDivideByZero = errors.New("integer divide by zero")
+
+func divInts(l, r Value) (Value, error) {
+	if isZero(r) {
+		return Value{}, ErrDivideByZero
+	}
+	if l.kind == KindInt && r.kind == KindInt {
+		if v, ok := divInt64(l.num, r.num); ok {
+			return Int(v), nil
+		}
+	}
+	return BigInt(new(big.Int).Quo(l.toBig(), r.toBig())), nil
+}
+
+func remInts(l, r Value) (Value, error) {
+	if isZero(r) {
+		return Value{}, ErrDivideByZero
+	}
+	if l.kind == KindInt && r.kind == KindInt {
+		return Int(remInt64(l.num, r.num)), nil
+	}
+	return BigInt(new(big.Int).Rem(l.toBig(), r.toBig())), nil
+}
+
+func isZero(v Value) bool {
+	if v.kind == KindBigInt {
+		return v.Big().Sign() == 0
+	}
+	return v.num == 0
+}
+
+// ------------------- modelos de inteiro
+
+type IntMode uint8
+
+const (
+	IntModeBigInt     IntMode = iota // int64, promovido para bigint no overflow
+	IntModeI64Checked                // int64, overflow é um erro de runtime
+	IntModeI64Wrap                   // int64 com overflow circular
+	IntModeI32                       // Int de 32 bits da especificação, com overflow circular
+)
+
+var intModeNames = []string{
+	IntModeBigInt:     "bigint",
+	IntModeI64Checked: "i64-checked",
+	IntModeI64Wrap:    "i64-wrap",
+	IntModeI32:        "i32",
+}
+
+func (m IntMode) String() string {
+	return intModeNames[m]
+}
+
+func ParseIntMode(name string) (IntMode, error) {
+	for m, n := range intModeNames {
+		if n == name {
+			return IntMode(m), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown int mode %q (expected i32, i64-wrap, i64-checked or bigint)", name)
+}
+
+var ErrIntegerOverflow = errors.New("integer overflow")
+
+// intOps são as operações inteiras de um modelo. Resultados int64 exatos
+// dentro de [min, max] valem em qualquer modelo, o que permite aos
+// executores e ao fold evitar a chamada indireta no caso comum.
+type intOps struct {
+	min, max                int64
+	bigints                 bool
+	literal                 func(v int64) Value
+	add, sub, mul, div, rem func(l, r Value) (Value, error)
+}
+
+func (m IntMode) ops() intOps {
+	if m == IntModeBigInt {
+		lift := func(f func(l, r Value) Value) func(l, r Value) (Value, error) {
+			return func(l, r Value) (Value, error) { return f(l, r), nil }
+		}
+		return intOps{
+			min: math.MinInt64, max: math.MaxInt64, literal: Int, bigints: true,
+			add: lift(addInts), sub: lift(subInts), mul: lift(mulInts), div: divInts, rem: remInts,
+		}
+	}
+
+	ops := intOps{min: math.MinInt64, max: math.MaxInt64, literal: Int}
+	fit := func(v int64, ok bool) (Value, error) { return Int(v), nil }
+	switch m {
+	case IntModeI64Checked:
+		fit = func(v int64, ok bool) (Value, error) {
+			if !ok {
+				return Value{}, ErrIntegerOverflow
+			}
+			return Int(v), nil
+		}
+	case IntModeI32:
+		ops.min, ops.max = math.MinInt32, math.MaxInt32
+		ops.literal = func(v int64) Value { return Int(int64(int32(v))) }
+		fit = func(v int64, ok bool) (Value, error) { return Int(int64(int32(v))), nil }
+	}
+	fixed := func(f func(l, r int64) (int64, bool), divides bool) func(l, r Value) (Value, error) {
+		return func(l, r Value) (Value, error) {
+			if divides && r.num == 0 {
+				return Value{}, ErrDivideByZero
+			}
+			return fit(f(l.num, r.num))
+		}
+	}
+	ops.add = fixed(addInt64, false)
+	ops.sub = fixed(subInt64, false)
+	ops.mul = fixed(mulInt64, false)
+	ops.div = fixed(divInt64, true)
+	ops.rem = fixed(func(l, r int64) (int64, bool) { return remInt64(l, r), true }, true)
+	return ops
+}
+
+// ------------------- float
+
+// Se algum operando é float, o outro é convertido para float64 e a
+// operação segue IEEE 754. A exceção é divisão e resto por zero, que são
+// erros como nos inteiros. O resto tem o sinal do dividendo (math.Mod).
+
+var ErrFloatDivideByZero = errors.New("float divide by zero")
+var ErrFloatNotFinite = errors.New("cannot convert a non-finite float to int")
+
+func toFloat64(v Value) float64 {
+	switch v.kind {
+	case KindFloat:
+		return v.Float()
+	case KindBigInt:
+		f, _ := new(big.Float).SetInt(v.Big()).Float64()
+		return f
+	}
+	return float64(v.num)
+}
+
+func isNumber(v Value) bool {
+	return v.kind == KindInt || v.kind == KindBigInt || v.kind == KindFloat
+}
+
+// unordered é o resultado de uma comparação com NaN. Como no IEEE 754,
+// NaN não é menor, maior nem igual a nenhum número, nem a si mesmo: só !=
+// é verdadeiro.
+const unordered = 2
+
+// compareNumbers compara inteiros de forma exata e, havendo um float, em
+// float64. Retorna -1, 0, 1 ou unordered.
+func compareNumbers(l, r Value) int {
+	if l.kind != KindFloat && r.kind != KindFloat {
+		return compareInts(l, r)
+	}
+	switch a, b := toFloat64(l), toFloat64(r); {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	}
+	return unordered
+}
+
+type numericOp struct {
+	ints   func(l, r Value) (Value, error)
+	floats func(l, r float64) (float64, error)
+}
+
+func (op numericOp) apply(l, r Value) (Value, error) {
+	if l.kind == KindFloat || r.kind == KindFloat {
+		f, err := op.floats(toFloat64(l), toFloat64(r))
+		return Float(f), err
+	}
+	return op.ints(l, r)
+}
+
+type numericOps struct {
+	add, sub, mul, div, rem numericOp
+}
+
+func (o intOps) numeric() numericOps {
+	return numericOps{
+		add: numericOp{o.add, func(l, r float64) (float64, error) { return l + r, nil }},
+		sub: numericOp{o.sub, func(l, r float64) (float64, error) { return l - r, nil }},
+		mul: numericOp{o.mul, func(l, r float64) (float64, error) { return l * r, nil }},
+		div: numericOp{o.div, func(l, r float64) (float64, error) {
+			if r == 0 {
+				return 0, ErrFloatDivideByZero
+			}
+			return l / r, nil
+		}},
+		rem: numericOp{o.rem, func(l, r float64) (float64, error) {
+			if r == 0 {
+				return 0, ErrFloatDivideByZero
+			}
+			return math.Mod(l, r), nil
+		}},
+	}
+}
+
+// fromFloat converte para inteiro truncando em direção a zero. Valores
+// fora de int64 viram bigint apenas no modelo bigint.
+func (o intOps) fromFloat(f float64) (Value, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Value{}, ErrFloatNotFinite
+	}
+	t := math.Trunc(f)
+	if t >= math.MinInt64 && t < math.MaxInt64 {
+		return o.literal(int64(t)), nil
+	}
+	if !o.bigints {
+		return Value{}, ErrIntegerOverflow
+	}
+	b, _ := big.NewFloat(t).Int(nil)
+	return BigInt(b), nil
+}
@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func bigValue(s string) Value {
+	b, _ := new(big.Int).SetString(s, 10)
+	return BigInt(b)
+}
+
+func TestIntArithmetic(t *testing.T) {
+	ops := map[string]func(l, r Value) Value{
+		"+": addInts, "-": subInts, "*": mulInts,
+		"/": func(l, r Value) Value { v, _ := divInts(l, r); return v },
+		"%": func(l, r Value) Value { v, _ := remInts(l, r); return v },
+	}
+	tests := []struct {
+		l    Value
+		op   string
+		r    Value
+		want string
+		kind Kind
+	}{
+		{Int(math.MaxInt64), "+", Int(1), "9223372036854775808", KindBigInt},
+		{Int(math.MinInt64), "+", Int(-1), "-9223372036854775809", KindBigInt},
+		{Int(math.MaxInt64), "+", Int(math.MinInt64), "-1", KindInt},
+		{Int(math.MinInt64), "-", Int(1), "-9223372036854775809", KindBigInt},
+		{Int(0), "-", Int(math.MinInt64), "9223372036854775808", KindBigInt},
+		{Int(-1), "-", Int(math.MinInt64), "9223372036854775807", KindInt},
+		{Int(math.MaxInt64), "-", Int(-1), "9223372036854775808", KindBigInt},
+		{Int(math.MinInt64), "*", Int(-1), "9223372036854775808", KindBigInt},
+		{Int(-1), "*", Int(math.MinInt64), "9223372036854775808", KindBigInt},
+		{Int(math.MinInt64), "*", Int(1), "-9223372036854775808", KindInt},
+		{Int(math.MinInt64), "*", Int(0), "0", KindInt},
+		{Int(0), "*", Int(math.MinInt64), "0", KindInt},
+		{Int(1 << 32), "*", Int(1 << 31), "9223372036854775808", KindBigInt},
+		{Int(-(1 << 32)), "*", Int(1 << 31), "-9223372036854775808", KindInt},
+		{Int(3037000500), "*", Int(3037000500), "9223372037000250000", KindBigInt},
+		{Int(math.MinInt64), "/", Int(-1), "9223372036854775808", KindBigInt},
+		{Int(math.MinInt64), "/", Int(1), "-9223372036854775808", KindInt},
+		{Int(-7), "/", Int(2), "-3", KindInt},
+		{Int(math.MinInt64), "%", Int(-1), "0", KindInt},
+		{Int(-7), "%", Int(2), "-1", KindInt},
+		{bigValue("9223372036854775808"), "+", Int(-1), "9223372036854775807", KindInt},
+		{Int(2), "*", bigValue("-9223372036854775809"), "-18446744073709551618", KindBigInt},
+		{bigValue("-18446744073709551617"), "/", Int(2), "-9223372036854775808", KindInt},
+		{bigValue("-18446744073709551617"), "%", Int(2), "-1", KindInt},
+		{Int(7), "%", bigValue("18446744073709551616"), "7", KindInt},
+		{bigValue("18446744073709551616"), "-", bigValue("18446744073709551616"), "0", KindInt},
+	}
+	for _, tt := range tests {
+		got := ops[tt.op](tt.l, tt.r)
+		if got.String() != tt.want || got.kind != tt.kind {
+			t.Errorf("%s %s %s = %s (kind %d), want %s (kind %d)", tt.l, tt.op, tt.r, got, got.kind, tt.want, tt.kind)
+		}
+	}
+}
+
+func TestIntNormalization(t *testing.T) {
+	over := addInts(Int(math.MaxInt64), Int(1))
+	if back := subInts(over, Int(1)); back.kind != KindInt || back.num != math.MaxInt64 {
+		t.Errorf("(MaxInt64 + 1) - 1 = %s (kind %d), want int64", back, back.kind)
+	}
+	if compareInts(over, Int(math.MaxInt64)) <= 0 || compareInts(Int(math.MinInt64), subInts(Int(math.MinInt64), Int(1))) <= 0 {
+		t.Errorf("bigint ordering against int64 is wrong")
+	}
+	if v := bigValue("42"); v.kind != KindInt || v.num != 42 {
+		t.Errorf("BigInt(42) = %s (kind %d), want int64", v, v.kind)
+	}
+}
+
+func TestIntDivision(t *testing.T) {
+	huge := bigValue("100000000000000000000")
+	tests := []struct {
+		l, r     Value
+		quo, rem string
+	}{
+		{Int(7), Int(2), "3", "1"},
+		{Int(-7), Int(2), "-3", "-1"},
+		{Int(7), Int(-2), "-3", "1"},
+		{Int(-7), Int(-2), "3", "-1"},
+		{Int(math.MinInt64), Int(-1), "9223372036854775808", "0"},
+		{Int(math.MinInt64), Int(2), "-4611686018427387904", "0"},
+		{huge, Int(-3), "-33333333333333333333", "1"},
+		{mulInts(huge, Int(-1)), Int(3), "-33333333333333333333", "-1"},
+		{Int(-7), huge, "0", "-7"},
+	}
+	for _, tt := range tests {
+		quo, err := divInts(tt.l, tt.r)
+		if err != nil || quo.String() != tt.quo {
+			t.Errorf("%s / %s = %s (%v), want %s", tt.l, tt.r, quo, err, tt.quo)
+		}
+		rem, err := remInts(tt.l, tt.r)
+		if err != nil || rem.String() != tt.rem {
+			t.Errorf("%s %% %s = %s (%v), want %s", tt.l, tt.r, rem, err, tt.rem)
+		}
+		if back := addInts(mulInts(quo, tt.r), rem); compareInts(back, tt.l) != 0 {
+			t.Errorf("(%s / %s) * %s + %s %% %s = %s", tt.l, tt.r, tt.r, tt.l, tt.r, back)
+		}
+	}
+
+	for _, l := range []Value{Int(1), Int(math.MinInt64), huge} {
+		if _, err := divInts(l, Int(0)); err != ErrDivideByZero {
+			t.Errorf("%s / 0: got %v, want ErrDivideByZero", l, err)
+		}
+		if _, err := remInts(l, Int(0)); err != ErrDivideByZero {
+			t.Errorf("%s %% 0: got %v, want ErrDivideByZero", l, err)
+		}
+	}
+}
+
+func TestIntModes(t *testing.T) {
+	tests := []struct {
+		mode IntMode
+		l    int64
+		op   string
+		r    int64
+		want string
+		err  error
+	}{
+		{IntModeI32, math.MaxInt32, "+", 1, "-2147483648", nil},
+		{IntModeI32, math.MinInt32, "-", 1, "2147483647", nil},
+		{IntModeI32, 65536, "*", 65536, "0", nil},
+		{IntModeI32, math.MinInt32, "/", -1, "-2147483648", nil},
+		{IntModeI32, -7, "%", 2, "-1", nil},
+		{IntModeI32, 1, "/", 0, "", ErrDivideByZero},
+		{IntModeI64Wrap, math.MaxInt64, "+", 1, "-9223372036854775808", nil},
+		{IntModeI64Wrap, math.MinInt64, "*", -1, "-9223372036854775808", nil},
+		{IntModeI64Wrap, math.MinInt64, "/", -1, "-9223372036854775808", nil},
+		{IntModeI64Checked, 2, "*", 3, "6", nil},
+		{IntModeI64Checked, math.MaxInt64, "+", 1, "", ErrIntegerOverflow},
+		{IntModeI64Checked, math.MinInt64, "-", 1, "", ErrIntegerOverflow},
+		{IntModeI64Checked, math.MinInt64, "/", -1, "", ErrIntegerOverflow},
+		{IntModeI64Checked, 1, "%", 0, "", ErrDivideByZero},
+		{IntModeBigInt, math.MinInt64, "*", -1, "9223372036854775808", nil},
+	}
+	for _, tt := range tests {
+		ints := tt.mode.ops()
+		op := map[string]func(l, r Value) (Value, error){
+			"+": ints.add, "-": ints.sub, "*": ints.mul, "/": ints.div, "%": ints.rem,
+		}[tt.op]
+		got, err := op(Int(tt.l), Int(tt.r))
+		if err != tt.err || (err == nil && got.String() != tt.want) {
+			t.Errorf("%s: %d %s %d = %s (%v), want %s (%v)", tt.mode, tt.l, tt.op, tt.r, got, err, tt.want, tt.err)
+		}
+	}
+
+	if v := IntModeI32.ops().literal(1<<32 + 1); v.num != 1 {
+		t.Errorf("i32 literal 2^32 + 1 = %s, want 1", v)
+	}
+	for _, name := range []string{"i32", "i64-wrap", "i64-checked", "bigint"} {
+		if m, err := ParseIntMode(name); err != nil || m.String() != name {
+			t.Errorf("ParseIntMode(%q) = %s, %v", name, m, err)
+		}
+	}
+	if _, err := ParseIntMode("i16"); err == nil {
+		t.Errorf("ParseIntMode accepted an unknown mode")
+	}
+}
@@ -1,39 +1,81 @@
 package interpreter
 
 import (
+	"cmp"
 	"fmt"
-	"math/big"
+	"io"
+	"math"
 	"os"
-	"reflect"
-	"slices"
-	"strconv"
 	"strings"
 )
 
-type NodeExecutor func() interface{}
+type NodeExecutor func() Value
+
+// Options configura a construção do programa
+type Options struct {
+	IntMode IntMode
+	Output  io.Writer // destino do print, os.Stdout quando nil
+	Print   PrintOptions
+	Memo    MemoOptions
+
+	// Warnings recebe os avisos do build, os.Stderr quando nil
+	Warnings io.Writer
+}
 
 func Build(file string) NodeExecutor {
+	return BuildWithOptions(file, Options{})
+}
+
+func BuildWithOptions(file string, opts Options) NodeExecutor {
 	code, ast := LoadAst(file)
+	return BuildAst(code, ast, opts)
+}
+
+// BuildAst constrói o programa a partir de uma AST já carregada; code é o
+// fonte usado nas mensagens de erro e pode ser vazio
+func BuildAst(code string, ast map[string]interface{}, opts Options) NodeExecutor {
+	if err := Validate(ast); err != nil {
+		loc := err.(*ValidationError).Location
+		reportError(code, loc, err.Error())
+		os.Exit(1)
+	}
+
+	ints := opts.IntMode.ops()
+	numeric := ints.numeric()
 
 	errorHandlers := []func(r interface{}){}
-	errorTypeDict := map[string]string{
-		"interpreter.Closure": "#closure",
-		"interpreter.Tuple":   "tuple",
-		"int64":               "int",
-		"string":              "string",
-		"bool":                "boolean",
+	errorTypeDict := map[Kind]string{
+		KindClosure: "#closure",
+		KindTuple:   "tuple",
+		KindInt:     "int",
+		KindBigInt:  "int",
+		KindFloat:   "float",
+		KindStr:     "string",
+		KindBool:    "boolean",
 	}
 
 	// ----- pré runtime
+	var budget *memoBudget
 	var scopeBuilder *ScopeBuilder
 	lastNodeLet := ""
-	scopedLets := []string{}
-	isDirtyClosure := false
-	closureDepth := 0
+	lastNodeLetSlot := -1
+	letChain, letChains := 0, 0 // bloco de lets em construção
+	memoized := []*Memoize{}    // caches das funções nomeadas, para as estatísticas
+	var store *memoStore
+	var rootLet map[string]interface{} // valor do let do root em construção
+	warn := func(format string, args ...interface{}) {
+		w := opts.Warnings
+		if w == nil {
+			w = os.Stderr
+		}
+		fmt.Fprintf(w, "warning: "+format+"\n", args...)
+	}
 	// ----
 
 	// ----- runtime
 	var currScopeInstance *ScopeInstance
+	var memoKey []byte
+	closureCount := uint64(0)
 	currentErrorHandlerIndex := 0
 	// -----
 
@@ -41,37 +83,43 @@ func Build(file string) NodeExecutor {
 	build = func(term map[string]interface{}) NodeExecutor {
 		if term["expression"] != nil {
 			exp := term["expression"].(map[string]interface{})
-			return func() interface{} {
+			return func() Value {
 				defer func() {
 					if r := recover(); r != nil {
 						errorHandlers[currentErrorHandlerIndex](r)
 					}
 				}()
-				root := newScopeBuilder()
+				if opts.Memo.Store != "" && opts.Memo.Policy != MemoOff {
+					var err error
+					if store, err = openMemoStore(opts.Memo.Store, opts.IntMode); err != nil {
+						warn("memo store disabled: %v", err)
+					}
+				}
+				// cada execução constrói caches novas, com um orçamento novo
+				budget = &memoBudget{maxEntries: opts.Memo.ProgramEntries, maxBytes: opts.Memo.MaxBytes}
+				memoized = nil
+				root := newScopeBuilder(nil)
 				scopeBuilder = root
 				run := build(exp)
 				currScopeInstance = root.New()
-				return run()
+				v := run()
+				if store != nil {
+					if err := store.Close(); err != nil {
+						warn("memo store: %v", err)
+					}
+				}
+				if opts.Memo.Stats != nil {
+					writeMemoStats(opts.Memo.Stats, memoized)
+				}
+				return v
 			}
 		}
 
 		// ----------------
 		errorHandlerIndex := len(errorHandlers)
 		errorHandlers = append(errorHandlers, func(r interface{}) {
-			loc := term["location"].(map[string]interface{})
-			if len(code) > 0 {
-				start := int(loc["start"].(float64))
-				end := int(loc["end"].(float64))
-				lines := strings.Split(code[:start], "\n")
-				errorLine := len(lines)
-				lineCol := -1
-				for i := 0; i < errorLine-1; i++ {
-					lineCol += len(lines[i]) + 1
-				}
-				fmt.Printf("\nError in file: '%s', line: %d, col: %d\n%s\n\n... %s ...\n\n\n", loc["filename"], errorLine, start-lineCol, fmt.Sprint(r), code[start:end])
-			} else {
-				fmt.Printf("\nError in file: '%s' (source code not found)\n\n... %s ...\n\n\n", loc["filename"], fmt.Sprint(r))
-			}
+			loc, _ := term["location"].(map[string]interface{})
+			reportError(code, loc, fmt.Sprint(r))
 			os.Exit(1)
 		})
 		emitError := func(v interface{}) {
@@ -84,200 +132,504 @@ func Build(file string) NodeExecutor {
 		switch term["kind"] {
 
 		case "Int":
-			val := int64(term["value"].(float64))
-			return func() interface{} { return val }
+			val := ints.literal(intLiteral(term["value"]))
+			return func() Value { return val }
 
-		case "Str", "Bool":
-			val := term["value"]
-			return func() interface{} { return val }
+		case "Float":
+			val := Float(term["value"].(float64))
+			return func() Value { return val }
+
+		case "Str":
+			val := Str(term["value"].(string))
+			return func() Value { return val }
+
+		case "Bool":
+			val := Bool(term["value"].(bool))
+			return func() Value { return val }
 
 		case "First":
 			tuple := build(term["value"].(map[string]interface{}))
-			return func() interface{} {
+			return func() Value {
 				v := tuple()
-				if t, ok := v.(Tuple); ok {
-					return t[0]
+				if v.kind == KindTuple {
+					return v.Tuple()[0]
 				} else {
-					emitError(fmt.Sprintf("Invalid tuple operation: first(<%s>)", errorTypeDict[fmt.Sprint(reflect.TypeOf(v))]))
-					return nil
+					emitError(fmt.Sprintf("Invalid tuple operation: first(<%s>): %s", errorTypeDict[v.kind], errorFormat.Format(v)))
+					return Value{}
 				}
 			}
 
 		case "Second":
 			tuple := build(term["value"].(map[string]interface{}))
-			return func() interface{} {
+			return func() Value {
 				v := tuple()
-				if t, ok := v.(Tuple); ok {
-					return t[1]
+				if v.kind == KindTuple {
+					return v.Tuple()[1]
 				} else {
-					emitError(fmt.Sprintf("Invalid tuple operation: second(<%s>)", errorTypeDict[fmt.Sprint(reflect.TypeOf(v))]))
-					return nil
+					emitError(fmt.Sprintf("Invalid tuple operation: second(<%s>): %s", errorTypeDict[v.kind], errorFormat.Format(v)))
+					return Value{}
 				}
 			}
 
 		case "Tuple":
 			first := build(term["first"].(map[string]interface{}))
 			second := build(term["second"].(map[string]interface{}))
-			return func() interface{} { return Tuple{first(), second()} }
+			return func() Value { return NewTuple(first(), second()) }
 
 		case "Let":
 			letName := term["name"].(map[string]interface{})["text"].(string)
-			lastNodeLet = letName
-			name := scopeBuilder.Register(letName)
-			val := build(term["value"].(map[string]interface{}))
-			lastNodeLet = ""
-			scopedLets = append(scopedLets, letName)
-			next := build(term["next"].(map[string]interface{}))
-			return func() interface{} {
-				g := val()
-				prev := currScopeInstance.Value(name, currScopeInstance.builder)
-				if prev != nil {
-					// a função antiga armazenada no let não será mais pura
-					if h, ok := prev.(*ScopeInstance); ok && h.builder.memoize != nil {
-						h.builder.memoize.enabled = false
-						h.builder.memoize.cache = nil
-					}
-				}
-				currScopeInstance.Set(name, g)
+			value := term["value"].(map[string]interface{})
+			chain := letChain
+			letChain = 0
+			if chain == 0 {
+				// primeiro let do bloco: reserva os slots de todos, para que
+				// funções possam usar lets definidos depois delas
+				letChains++
+				chain = letChains
+				names := []string{}
+				for let := term; let["kind"] == "Let"; let = let["next"].(map[string]interface{}) {
+					names = append(names, let["name"].(map[string]interface{})["text"].(string))
+				}
+				scopeBuilder.Forward(chain, names)
+			}
+			name, release, reserved := scopeBuilder.Claim(letName, chain)
+			if !reserved {
+				name, release = scopeBuilder.Declare(), func() {}
+			}
+			enclosing := rootLet == nil && scopeBuilder.parent == nil
+			if enclosing {
+				rootLet = value
+			}
+			var val NodeExecutor
+			var restore func()
+			if value["kind"] == "Function" {
+				// o nome já é visível dentro da função para permitir recursão
+				restore = scopeBuilder.Bind(letName, name)
+				lastNodeLet, lastNodeLetSlot = letName, name
+				val = build(value)
+			} else {
+				val = build(value)
+				restore = scopeBuilder.Bind(letName, name)
+			}
+			release()
+			if enclosing {
+				rootLet = nil
+			}
+			if store != nil && scopeBuilder.parent == nil {
+				store.define(letName, value)
+			}
+			nextTerm := term["next"].(map[string]interface{})
+			if nextTerm["kind"] == "Let" {
+				letChain = chain
+			}
+			next := build(nextTerm)
+			restore()
+			if scopeBuilder.cells[name] {
+				// funções criadas antes do let guardaram a cell do slot
+				return func() Value {
+					frame := currScopeInstance
+					c := frame.cell(name).cell()
+					c.value = val()
+					frame.Set(name, c.value)
+					return next()
+				}
+			}
+			return func() Value {
+				currScopeInstance.Set(name, val())
 				return next()
 			}
 
 		case "Var":
-			scope := scopeBuilder
 			varName := term["text"].(string)
-			name := scopeBuilder.Register(varName)
-			isDirtyClosure = isDirtyClosure || !slices.Contains(scopedLets, varName)
-			return func() interface{} {
-				v := currScopeInstance.Value(name, scope)
-				if v == nil {
-					v = currScopeInstance.parent.Find(varName)
-				}
-				if v == nil {
+			index, captured, found := scopeBuilder.Resolve(varName)
+			if !found {
+				return func() Value {
+					emitError("var not found")
+					return Value{}
+				}
+			}
+			if captured && scopeBuilder.captures[index].cell {
+				return func() Value {
+					v := currScopeInstance.closure.captured[index].cell().value
+					if v.IsNone() {
+						emitError("var not found")
+					}
+					return v
+				}
+			}
+			if captured {
+				return func() Value {
+					v := currScopeInstance.closure.captured[index]
+					if v.IsNone() {
+						emitError("var not found")
+					}
+					return v
+				}
+			}
+			return func() Value {
+				v := currScopeInstance.data[index]
+				if v.IsNone() {
 					emitError("var not found")
 				}
 				return v
 			}
 
 		case "Call":
-			callee := build(term["callee"].(map[string]interface{}))
+			calleeTerm := term["callee"].(map[string]interface{})
+			if name, _ := calleeTerm["text"].(string); calleeTerm["kind"] == "Var" && (name == "to_int" || name == "to_float") {
+				// conversões numéricas, a menos que o nome tenha sido redefinido
+				if _, _, found := scopeBuilder.Resolve(name); !found {
+					args := term["arguments"].([]interface{})
+					if len(args) != 1 {
+						return func() Value {
+							emitError("Wrong number of arguments")
+							return Value{}
+						}
+					}
+					arg := build(args[0].(map[string]interface{}))
+					return func() Value {
+						v := arg()
+						switch {
+						case v.kind == KindFloat && name == "to_int":
+							i, err := ints.fromFloat(v.Float())
+							if err != nil {
+								emitError(err.Error())
+							}
+							return i
+						case isNumber(v) && name == "to_float":
+							return Float(toFloat64(v))
+						case isNumber(v):
+							return v
+						}
+						emitError(fmt.Sprintf("Invalid conversion: %s(<%s>)", name, errorTypeDict[v.kind]))
+						return Value{}
+					}
+				}
+			}
+			callee := build(calleeTerm)
+			var static *ScopeBuilder
+			if calleeTerm["kind"] == "Var" {
+				static = scopeBuilder.StaticFunction(calleeTerm["text"].(string))
+			}
 			args := make([]NodeExecutor, len(term["arguments"].([]interface{})))
 			for i, t := range term["arguments"].([]interface{}) {
 				args[i] = build(t.(map[string]interface{}))
 			}
 
 			argsLen := len(args)
-			var scopeInstance *ScopeInstance
-			return func() interface{} {
-				x := callee()
-				if a, ok := x.(*ScopeInstance); ok {
-					scopeInstance = a
-					if len(a.builder.paramIndexes) != argsLen {
-						emitError("Wrong number of arguments")
-					}
-				} else {
-					emitError(fmt.Sprintf("it is not possible to call a <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(x))]))
+			invoke := func(fn *ScopeBuilder, closure *Closure) Value {
+				params := fn.paramIndexes
+				memoize := fn.memoize
+				memoize.calls++
+				if fn.memoPerClosure && memoize.enabled {
+					memoize = closure.cache(memoize)
 				}
-
-				params := scopeInstance.builder.paramIndexes
-				if scopeInstance.builder.memoize.enabled {
-					memoize := scopeInstance.builder.memoize
-					key := ""
-					child := scopeInstance.Child(scopeInstance.builder)
+				if memoize.enabled {
+					child := fn.Frame(closure)
 					for i, arg := range args {
-						switch a := arg().(type) {
-						case int64:
-							key += strconv.FormatInt(a, 10) + ","
-							child.Set(params[i], arg())
-						case *big.Int:
-							key += a.String() + ","
-							child.Set(params[i], arg())
-						default: // se não tiver valor valido desabilita a cache
-							memoize.enabled = false
-							child.Set(params[i], arg())
-						}
+						child.Set(params[i], arg())
 					}
-					if v, h := memoize.cache[key]; h {
-						memoize.cacheMiss = 0
+					callArgs := child.data[:argsLen]
+					intKey, isInts := intMemoKey(callArgs)
+					var key []byte
+					if !isInts {
+						var cacheable bool
+						key, cacheable = appendMemoKey(memoKey[:0], callArgs)
+						memoKey = key[:0]
+						if !cacheable {
+							memoize.skipped++
+							prev := currScopeInstance
+							currScopeInstance = child
+							v := fn.body()
+							currScopeInstance = prev
+							fn.Release(child)
+							return v
+						}
+					}
+					var v Value
+					var h bool
+					if isInts {
+						v, h = memoize.getInts(intKey)
+					} else {
+						v, h = memoize.get(key)
+					}
+					if h {
+						fn.Release(child)
 						return v
-					} else if memoize.cacheSize == MemoizeCacheLimit {
-						if memoize.cacheMiss == 1000000 {
-							memoize.enabled = false
-						} else {
-							memoize.cacheMiss++
+					}
+					// a chamada pode reutilizar o buffer da chave
+					k := ""
+					if !isInts {
+						k = string(key)
+					}
+					persist := memoize.store != nil && storable(callArgs...)
+					if persist {
+						if isInts {
+							b, _ := appendMemoKey(nil, callArgs)
+							k = string(b)
+						}
+						if v, ok := memoize.load(k); ok {
+							fn.Release(child)
+							if isInts {
+								memoize.putInts(intKey, v)
+							} else {
+								memoize.put(k, v)
+							}
+							return v
 						}
 					}
 					prev := currScopeInstance
 					currScopeInstance = child
-					v := scopeInstance.builder.body()
+					v = fn.body()
 					currScopeInstance = prev
-					if memoize.enabled {
-						if memoize.cacheSize >= MemoizeCacheLimit {
-							for k := range memoize.cache {
-								delete(memoize.cache, k)
-								break
-							}
+					fn.Release(child)
+					if memoize.enabled && !hasClosure(v) {
+						if isInts {
+							memoize.putInts(intKey, v)
 						} else {
-							memoize.cacheSize++
+							memoize.put(k, v)
+						}
+						if persist {
+							memoize.save(k, v)
 						}
-						memoize.cache[key] = v
 					}
 					return v
 				} else {
-					child := scopeInstance.Child(scopeInstance.builder)
+					child := fn.Frame(closure)
 					for i, arg := range args {
 						child.Set(params[i], arg())
 					}
 					prev := currScopeInstance
 					currScopeInstance = child
-					v := scopeInstance.builder.body()
+					v := fn.body()
 					currScopeInstance = prev
+					fn.Release(child)
 					return v
 				}
 			}
 
+			// chamada direta: a função é conhecida em tempo de build, então a
+			// checagem de tipo e aridade já foi feita aqui
+			if static != nil {
+				if len(static.paramIndexes) != argsLen {
+					return func() Value {
+						emitError("Wrong number of arguments")
+						return Value{}
+					}
+				}
+				return func() Value {
+					return invoke(static, callee().Closure())
+				}
+			}
+
+			return func() Value {
+				var closure *Closure
+				x := callee()
+				if x.kind == KindClosure {
+					closure = x.Closure()
+					if len(closure.builder.paramIndexes) != argsLen {
+						emitError("Wrong number of arguments")
+					}
+				} else {
+					emitError(fmt.Sprintf("it is not possible to call a <%s>: %s", errorTypeDict[x.kind], errorFormat.Format(x)))
+				}
+				return invoke(closure.builder, closure)
+			}
+
 		case "Function":
 			prevScope := scopeBuilder
-			scope := newScopeBuilder()
+			scope := newScopeBuilder(prevScope)
 			scopeBuilder = scope
 
 			ownerLet := lastNodeLet
-			prevScopedLets := scopedLets
-			scopedLets = []string{ownerLet}
+			if ownerLet != "" {
+				scope.ownerSlot = lastNodeLetSlot
+				prevScope.functions[lastNodeLetSlot] = scope
+			}
+			lastNodeLet, lastNodeLetSlot = "", -1
+			statsSlot := len(memoized) // reservado antes do corpo, para manter a ordem do código
+			if ownerLet != "" {
+				memoized = append(memoized, nil)
+			}
 			scope.paramIndexes = make([]int, len(term["parameters"].([]interface{})))
 			for i, p := range term["parameters"].([]interface{}) {
-				paramName := p.(map[string]interface{})["text"].(string)
-				scope.paramIndexes[i] = scope.Register(paramName)
-				scopedLets = append(scopedLets, paramName)
-			}
-			if closureDepth == 0 { // apenas reseta quando a função está no root
-				isDirtyClosure = false
+				scope.paramIndexes[i] = scope.Register(p.(map[string]interface{})["text"].(string))
 			}
-			closureDepth++
 			scope.body = build(term["value"].(map[string]interface{}))
-			closureDepth--
 			scopeBuilder = prevScope
-			defer func() { scopedLets = prevScopedLets }()
 
 			// Memoize
-			scope.memoize = &Memoize{cache: map[string]interface{}{}}
-			scope.memoize.enabled = ownerLet != "" && !isDirtyClosure
+			effect := term["effect"].(*FunctionEffect)
+			scope.keyable = effect.MemoSafe
+			scope.memoize = newMemoize(opts.Memo, budget)
+			// diretivas @memo e @nomemo do código têm prioridade sobre a análise
+			directive, _ := term["memo"].(map[string]interface{})
+			forced := directive["enabled"] == true
+			switch {
+			case !scope.memoize.enabled:
+				scope.memoize.reason = "memo policy is off"
+			case directive != nil && !forced:
+				scope.memoize.reason = "disabled by @nomemo"
+			case effect.Effect == EffectEffectful && forced:
+				warn("%s: @memo on effectful function '%s'", position(code, term["location"]), ownerLet)
+			case effect.Effect == EffectEffectful:
+				scope.memoize.reason = "effectful"
+			}
+			scope.memoize.enabled = scope.memoize.reason == "" && ownerLet != ""
+			if limit, ok := directive["limit"]; ok {
+				scope.memoize.limit = int(intLiteral(limit))
+			}
+			// o resultado depende das variáveis capturadas, que não mudam
+			// durante a vida da closure: cada closure tem sua cache
+			scope.memoPerClosure = !effect.MemoSafe
+			if ownerLet != "" {
+				scope.memoize.name = ownerLet
+				scope.memoize.location = position(code, term["location"])
+				memoized[statsSlot] = scope.memoize
+			}
+			if store != nil && scope.memoize.enabled && !scope.memoPerClosure {
+				store.attach(scope.memoize, term, rootLet)
+			}
+
+			return func() Value {
+				closureCount++
+				closure := &Closure{builder: scope, captured: make([]Value, len(scope.captures)), id: closureCount}
+				for i, c := range scope.captures {
+					if c.local && c.cell {
+						closure.captured[i] = currScopeInstance.cell(c.index)
+					} else if c.local {
+						closure.captured[i] = currScopeInstance.data[c.index]
+					} else {
+						closure.captured[i] = currScopeInstance.closure.captured[c.index]
+					}
+				}
+				if scope.selfCapture >= 0 {
+					closure.captured[scope.selfCapture] = closureValue(closure)
+				}
+				return closureValue(closure)
+			}
+
+		case "Loop":
+			// recursão linear reescrita por Accumulate; o escopo atual é o da
+			// função
+			fn := scopeBuilder
+			recurse := build(term["condition"].(map[string]interface{}))
+			element := build(term["element"].(map[string]interface{}))
+			args := []NodeExecutor{}
+			for _, a := range term["arguments"].([]interface{}) {
+				args = append(args, build(a.(map[string]interface{})))
+			}
+			base := build(term["base"].(map[string]interface{}))
+			elementSlot, restSlot := fn.Register("#element"), fn.Register("#rest")
+			combine := build(term["combine"].(map[string]interface{}))
+			params := fn.paramIndexes
+			add := term["op"] == "Add"
+			intOp := ints.mul
+			if add {
+				intOp = ints.add
+			}
+			// repetir a avaliação só é seguro sem efeitos
+			accumulate := term["effect"].(*FunctionEffect).Effect != EffectEffectful && opts.IntMode != IntModeI64Checked
+
+			step := func(frame *ScopeInstance, next []Value) {
+				for i, arg := range args {
+					next[i] = arg()
+				}
+				for i, p := range params {
+					frame.data[p] = next[i]
+				}
+			}
+
+			// acumula inteiros ou strings; false quando aparece um valor
+			// em que a ordem da combinação importa
+			accumulated := func(frame *ScopeInstance, next []Value) (Value, bool) {
+				var acc Value // soma ou produto dos inteiros
+				var text []byte
+				isText := false
+				for recurse().Bool() {
+					switch e := element(); {
+					case (e.kind == KindInt || e.kind == KindBigInt) && !isText:
+						if acc.kind == KindNone {
+							acc = e
+						} else if v, err := intOp(acc, e); err == nil {
+							acc = v
+						} else {
+							return Value{}, false
+						}
+					case add && e.kind == KindStr && acc.kind == KindNone:
+						isText = true
+						text = append(text, e.Str()...)
+					default:
+						return Value{}, false
+					}
+					step(frame, next)
+				}
+				switch b := base(); {
+				case isText && b.kind == KindStr:
+					return Str(string(text) + b.Str()), true
+				case isText && (b.kind == KindInt || b.kind == KindBigInt || b.kind == KindFloat):
+					return Str(string(text) + b.String()), true
+				case acc.kind == KindNone && !isText:
+					return b, true
+				case acc.kind != KindNone && (b.kind == KindInt || b.kind == KindBigInt):
+					v, err := intOp(acc, b)
+					return v, err == nil
+				}
+				return Value{}, false
+			}
 
-			return func() interface{} {
-				return currScopeInstance.Child(scope)
+			// guarda cada valor e combina da direita para a esquerda, como a
+			// recursão faria
+			exact := func(frame *ScopeInstance, next []Value) Value {
+				var elements []Value
+				for recurse().Bool() {
+					e := element()
+					if e.kind != KindInt && e.kind != KindBigInt && e.kind != KindFloat && !(add && e.kind == KindStr) {
+						// o operador rejeita o lado esquerdo antes de avaliar a chamada
+						frame.data[elementSlot] = e
+						combine()
+					}
+					elements = append(elements, e)
+					step(frame, next)
+				}
+				v := base()
+				for i := len(elements) - 1; i >= 0; i-- {
+					frame.data[elementSlot], frame.data[restSlot] = elements[i], v
+					v = combine()
+				}
+				return v
+			}
+
+			return func() Value {
+				frame := currScopeInstance
+				next := make([]Value, len(args))
+				if accumulate {
+					initial := make([]Value, len(params))
+					for i, p := range params {
+						initial[i] = frame.data[p]
+					}
+					if v, ok := accumulated(frame, next); ok {
+						return v
+					}
+					for i, p := range params {
+						frame.data[p] = initial[i]
+					}
+				}
+				return exact(frame, next)
 			}
 
 		case "If":
 			condition := build(term["condition"].(map[string]interface{}))
 			then := build(term["then"].(map[string]interface{}))
 			otherwise := build(term["otherwise"].(map[string]interface{}))
-			return func() interface{} {
+			return func() Value {
 				v := condition()
-				if b, ok := v.(bool); ok {
-					if b {
+				if v.kind == KindBool {
+					if v.Bool() {
 						return then()
 					}
 				} else {
-					emitError(fmt.Sprintf("Invalid type: if(<%s>)", errorTypeDict[fmt.Sprint(reflect.TypeOf(v))]))
+					emitError(fmt.Sprintf("Invalid type: if(<%s>): %s", errorTypeDict[v.kind], errorFormat.Format(v)))
 				}
 				return otherwise()
 			}
@@ -288,488 +640,379 @@ func Build(file string) NodeExecutor {
 
 			// otimização quando o rhs é um literal Int ou Bool
 			if rightKind := term["rhs"].(map[string]interface{})["kind"]; rightKind == "Int" {
+				rv := rhs()
+				r := rv.num
 				switch term["op"] {
 				case "Sub":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l - r
-						case *big.Int:
-							return big.NewInt(0).Sub(l, big.NewInt(r))
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt, KindBigInt, KindFloat:
+							if l.kind == KindInt {
+								if v, ok := subInt64(l.num, r); ok && v >= ints.min && v <= ints.max {
+									return Int(v)
+								}
+							}
+							v, err := numeric.sub.apply(l, rv)
+							if err != nil {
+								emitError(err.Error())
+							}
+							return v
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> - <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> - <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Mul":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l * r
-						case *big.Int:
-							return big.NewInt(0).Mul(l, big.NewInt(r))
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt, KindBigInt, KindFloat:
+							if l.kind == KindInt {
+								if v, ok := mulInt64(l.num, r); ok && v >= ints.min && v <= ints.max {
+									return Int(v)
+								}
+							}
+							v, err := numeric.mul.apply(l, rv)
+							if err != nil {
+								emitError(err.Error())
+							}
+							return v
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> * <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> * <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Div":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							if r == 0 {
-								emitError("Integer divide by zero")
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt, KindBigInt, KindFloat:
+							v, err := numeric.div.apply(l, rv)
+							if err != nil {
+								emitError(err.Error())
 							}
-							return l / r
-						case *big.Int:
-							return big.NewInt(0).Div(l, big.NewInt(r))
+							return v
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> / <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> / <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Rem":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l % r
-						case *big.Int:
-							return big.NewInt(0).Rem(l, big.NewInt(r))
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt, KindBigInt, KindFloat:
+							v, err := numeric.rem.apply(l, rv)
+							if err != nil {
+								emitError(err.Error())
+							}
+							return v
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], "%", errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[l.kind], "%", errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Lt":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l < r
-						case *big.Int:
-							return l.Cmp(big.NewInt(r)) == -1
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt:
+							return Bool(l.num < r)
+						case KindBigInt, KindFloat:
+							return Bool(compareNumbers(l, rv) == -1)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Lte":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l <= r
-						case *big.Int:
-							return l.Cmp(big.NewInt(r)) <= 0
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt:
+							return Bool(l.num <= r)
+						case KindBigInt, KindFloat:
+							c := compareNumbers(l, rv)
+							return Bool(c == -1 || c == 0)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Gt":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l > r
-						case *big.Int:
-							return l.Cmp(big.NewInt(r)) == 1
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt:
+							return Bool(l.num > r)
+						case KindBigInt, KindFloat:
+							return Bool(compareNumbers(l, rv) == 1)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Gte":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l >= r
-						case *big.Int:
-							return l.Cmp(big.NewInt(r)) >= 0
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt:
+							return Bool(l.num >= r)
+						case KindBigInt, KindFloat:
+							c := compareNumbers(l, rv)
+							return Bool(c == 1 || c == 0)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				case "Eq":
-					r := rhs().(int64)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case int64:
-							return l == r
-						case *big.Int:
-							return l.Cmp(big.NewInt(r)) == 0
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindInt:
+							return Bool(l.num == r)
+						case KindBigInt:
+							return Bool(false) // um bigint nunca é igual a um int64
+						case KindFloat:
+							return Bool(compareNumbers(l, rv) == 0)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> == <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> == <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				}
 			} else if rightKind == "Bool" {
 				switch term["op"] {
 				case "Eq":
-					r := rhs().(bool)
-					return func() interface{} {
-						switch l := lhs().(type) {
-						case bool:
-							return l == r
+					rv := rhs()
+					r := rv.Bool()
+					return func() Value {
+						switch l := lhs(); l.kind {
+						case KindBool:
+							return Bool(l.Bool() == r)
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> == <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> == <%s>", errorTypeDict[l.kind], errorTypeDict[rv.kind]))
 						}
-						return nil
+						return Value{}
 					}
 				}
 			}
 
 			switch term["op"] {
 			case "Add":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							if isAddOverflow(l, r) {
-								return big.NewInt(0).Add(big.NewInt(l), big.NewInt(r))
+				return func() Value {
+					switch l := lhs(); l.kind {
+					case KindInt, KindBigInt, KindFloat:
+						switch r := rhs(); r.kind {
+						case KindInt, KindBigInt, KindFloat:
+							if l.kind == KindInt && r.kind == KindInt {
+								if v, ok := addInt64(l.num, r.num); ok && v >= ints.min && v <= ints.max {
+									return Int(v)
+								}
 							}
-							return l + r
-						case *big.Int:
-							return big.NewInt(0).Add(big.NewInt(l), r)
-						case string:
-							return strconv.FormatInt(l, 10) + r
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> + <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return big.NewInt(0).Add(l, big.NewInt(r))
-						case *big.Int:
-							return big.NewInt(0).Add(l, r)
-						case string:
-							return l.String() + r
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> + <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case string:
-						switch r := rhs().(type) {
-						case int64:
-							return l + strconv.FormatInt(r, 10)
-						case *big.Int:
-							return l + r.String()
-						case string:
-							return l + r
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> + <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> + ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					return nil
-				}
-			case "Sub":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							if isAddOverflow(l, -r) {
-								return big.NewInt(0).Sub(big.NewInt(l), big.NewInt(r))
+							v, err := numeric.add.apply(l, r)
+							if err != nil {
+								emitError(err.Error())
 							}
-							return l - r
-						case *big.Int:
-							return big.NewInt(0).Sub(big.NewInt(l), r)
+							return v
+						case KindStr:
+							return Str(l.String() + r.Str())
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> - <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> + <%s>", errorTypeDict[l.kind], errorTypeDict[r.kind]))
 						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return big.NewInt(0).Sub(l, big.NewInt(r))
-						case *big.Int:
-							return big.NewInt(0).Sub(l, r)
+					case KindStr:
+						switch r := rhs(); r.kind {
+						case KindInt, KindBigInt, KindFloat:
+							return Str(l.Str() + r.String())
+						case KindStr:
+							return Str(l.Str() + r.Str())
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> - <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> + <%s>", errorTypeDict[l.kind], errorTypeDict[r.kind]))
 						}
 					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> - ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
+						emitError(fmt.Sprintf("Invalid binary operation: <%s> + ...", errorTypeDict[l.kind]))
 					}
-					return nil
+					return Value{}
 				}
 
-			case "Mul":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l * r
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> * <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> * ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					// TODO: suportar bigint
-					return nil
+			case "Sub", "Mul", "Div", "Rem":
+				var calc numericOp
+				op := ""
+				switch term["op"] {
+				case "Sub":
+					calc, op = numeric.sub, "-"
+				case "Mul":
+					calc, op = numeric.mul, "*"
+				case "Div":
+					calc, op = numeric.div, "/"
+				case "Rem":
+					calc, op = numeric.rem, "%"
 				}
-
-			case "Div":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							if r == 0 {
-								emitError("integer divide by zero")
+				return func() Value {
+					switch l := lhs(); l.kind {
+					case KindInt, KindBigInt, KindFloat:
+						switch r := rhs(); r.kind {
+						case KindInt, KindBigInt, KindFloat:
+							v, err := calc.apply(l, r)
+							if err != nil {
+								emitError(err.Error())
 							}
-							return l / r
+							return v
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> / <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[l.kind], op, errorTypeDict[r.kind]))
 						}
 					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> / ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
+						emitError(fmt.Sprintf("Invalid binary operation: <%s> %s ...", errorTypeDict[l.kind], op))
 					}
-					// TODO: suportar bigint
-					return nil
+					return Value{}
 				}
 
-			case "Rem":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l % r
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], "%", errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> %s ...", "%", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					// TODO: suportar bigint
-					return nil
+			case "Lt", "Lte", "Gt", "Gte", "Eq", "Neq":
+				var test func(c int) bool
+				op := ""
+				switch term["op"] {
+				case "Lt":
+					test, op = func(c int) bool { return c == -1 }, "<"
+				case "Lte":
+					test, op = func(c int) bool { return c == -1 || c == 0 }, "<="
+				case "Gt":
+					test, op = func(c int) bool { return c == 1 }, ">"
+				case "Gte":
+					test, op = func(c int) bool { return c == 1 || c == 0 }, ">="
+				case "Eq":
+					test, op = func(c int) bool { return c == 0 }, "=="
+				case "Neq":
+					test, op = func(c int) bool { return c != 0 }, "!="
 				}
-
-			case "Lt":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l < r
-						case *big.Int:
-							return r.Cmp(big.NewInt(l)) == 1
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return l.Cmp(big.NewInt(r)) == -1
-						case *big.Int:
-							return l.Cmp(r) == -1
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> < ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					return nil
-				}
-			case "Lte":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l <= r
-						case *big.Int:
-							return r.Cmp(big.NewInt(l)) >= 0
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return l.Cmp(big.NewInt(r)) <= 0
-						case *big.Int:
-							return l.Cmp(r) <= 0
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> < <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> < ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					return nil
-				}
-			case "Gt":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l > r
-						case *big.Int:
-							return r.Cmp(big.NewInt(l)) == -1
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return l.Cmp(big.NewInt(r)) == 1
-						case *big.Int:
-							return l.Cmp(r) == 1
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> > ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					return nil
-				}
-			case "Gte":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l >= r
-						case *big.Int:
-							return r.Cmp(big.NewInt(l)) <= 0
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return l.Cmp(big.NewInt(r)) >= 0
-						case *big.Int:
-							return l.Cmp(r) >= 0
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> > <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> > ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
-					}
-					return nil
-				}
-			case "Eq", "Neq":
-				sign := true
-				op := "=="
-				if term["op"] == "Neq" {
-					sign = false
-					op = "!="
-				}
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case int64:
-						switch r := rhs().(type) {
-						case int64:
-							return l == r == sign
-						case *big.Int:
-							return r.Cmp(big.NewInt(l)) == 0 == sign
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], op, errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case *big.Int:
-						switch r := rhs().(type) {
-						case int64:
-							return l.Cmp(big.NewInt(r)) == 0 == sign
-						case *big.Int:
-							return l.Cmp(r) == 0 == sign
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], op, errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-
-					case bool:
-						switch r := rhs().(type) {
-						case bool:
-							return l == r == sign
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], op, errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
-						}
-					case string:
-						switch r := rhs().(type) {
-						case string:
-							return l == r == sign
-						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], op, errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+				ordered := op != "==" && op != "!="
+				return func() Value {
+					l, r := lhs(), rhs()
+					if l.kind == KindInt && r.kind == KindInt {
+						return Bool(test(cmp.Compare(l.num, r.num)))
+					}
+					c, bad, ok := compareValues(l, r, ordered)
+					if !ok {
+						msg := fmt.Sprintf("Invalid binary operation: <%s> %s <%s>", errorTypeDict[l.kind], op, errorTypeDict[r.kind])
+						if bad != [2]Kind{l.kind, r.kind} {
+							msg += fmt.Sprintf(" (cannot compare <%s> with <%s>)", errorTypeDict[bad[0]], errorTypeDict[bad[1]])
 						}
-					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> %s ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], op))
+						emitError(msg)
 					}
-					return nil
+					return Bool(test(c))
 				}
 			case "Or":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case bool:
-						switch r := rhs().(type) {
-						case bool:
-							return l || r
+				return func() Value {
+					switch l := lhs(); l.kind {
+					case KindBool:
+						if l.Bool() {
+							return l
+						}
+						switch r := rhs(); r.kind {
+						case KindBool:
+							return r
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> || <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> || <%s>", errorTypeDict[l.kind], errorTypeDict[r.kind]))
 						}
 					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> || ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
+						emitError(fmt.Sprintf("Invalid binary operation: <%s> || ...", errorTypeDict[l.kind]))
 					}
-					return nil
+					return Value{}
 				}
 			case "And":
-				return func() interface{} {
-					switch l := lhs().(type) {
-					case bool:
-						switch r := rhs().(type) {
-						case bool:
-							return l && r
+				return func() Value {
+					switch l := lhs(); l.kind {
+					case KindBool:
+						if !l.Bool() {
+							return l
+						}
+						switch r := rhs(); r.kind {
+						case KindBool:
+							return r
 						default:
-							emitError(fmt.Sprintf("Invalid binary operation: <%s> && <%s>", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))], errorTypeDict[fmt.Sprint(reflect.TypeOf(r))]))
+							emitError(fmt.Sprintf("Invalid binary operation: <%s> && <%s>", errorTypeDict[l.kind], errorTypeDict[r.kind]))
 						}
 					default:
-						emitError(fmt.Sprintf("Invalid binary operation: <%s> && ...", errorTypeDict[fmt.Sprint(reflect.TypeOf(l))]))
+						emitError(fmt.Sprintf("Invalid binary operation: <%s> && ...", errorTypeDict[l.kind]))
 					}
-					return nil
+					return Value{}
 				}
 			}
 
-		case "Print":
-			isDirtyClosure = true
+		case "Unary":
 			val := build(term["value"].(map[string]interface{}))
-
-			var print func(o interface{}) string
-			print = func(o interface{}) string {
-				switch v := o.(type) {
-				case *ScopeInstance:
-					if v.builder.memoize != nil {
-						return "<#closure>"
-					} else {
-						return fmt.Sprint(v)
+			if term["op"] == "Not" {
+				return func() Value {
+					v := val()
+					if v.kind != KindBool {
+						emitError(fmt.Sprintf("Invalid unary operation: !<%s>", errorTypeDict[v.kind]))
 					}
-				case Tuple:
-					s := []string{}
-					for _, d := range v {
-						s = append(s, print(d))
-					}
-					return "(" + strings.Join(s, ", ") + ")"
+					return Bool(!v.Bool())
+				}
+			}
+			zero := Int(0)
+			return func() Value {
+				switch v := val(); v.kind {
+				case KindInt:
+					// -MinInt64 não cabe em int64 e fica a cargo do modelo de inteiros
+					if v.num != math.MinInt64 && -v.num >= ints.min && -v.num <= ints.max {
+						return Int(-v.num)
+					}
+					fallthrough
+				case KindBigInt:
+					r, err := ints.sub(zero, v)
+					if err != nil {
+						emitError(err.Error())
+					}
+					return r
+				case KindFloat:
+					return Float(-v.Float())
 				default:
-					return fmt.Sprint(v)
+					emitError(fmt.Sprintf("Invalid unary operation: -<%s>", errorTypeDict[v.kind]))
 				}
+				return Value{}
 			}
 
-			return func() interface{} {
+		case "Print":
+			val := build(term["value"].(map[string]interface{}))
+			return func() Value {
 				v := val()
-				fmt.Println(print(v))
+				out := opts.Output
+				if out == nil {
+					out = os.Stdout
+				}
+				opts.Print.WriteLine(out, v)
 				return v
 			}
 		}
 		return nil
 	}
 
-	return build(ast)
+	return build(Accumulate(AnalyzeEffects(Fold(ast, opts.IntMode))))
+}
+
+// reportError mostra msg apontando o trecho do código em loc
+func reportError(code string, loc map[string]interface{}, msg string) {
+	if loc == nil {
+		fmt.Printf("\nError: %s\n\n\n", msg)
+	} else if len(code) > 0 {
+		start := int(loc["start"].(float64))
+		end := int(loc["end"].(float64))
+		line, col := lineCol(code, start)
+		fmt.Printf("\nError in file: '%s', line: %d, col: %d\n%s\n\n... %s ...\n\n\n", loc["filename"], line, col, msg, code[start:end])
+	} else {
+		fmt.Printf("\nError in file: '%s' (source code not found)\n\n... %s ...\n\n\n", loc["filename"], msg)
+	}
+}
+
+// lineCol converte um offset do código em linha e coluna, a partir de 1
+func lineCol(code string, offset int) (line, col int) {
+	lines := strings.Split(code[:offset], "\n")
+	return len(lines), len(lines[len(lines)-1]) + 1
+}
+
+// position descreve uma localização da AST como arquivo:linha:coluna
+func position(code string, location interface{}) string {
+	loc, ok := location.(map[string]interface{})
+	if !ok {
+		return "-"
+	}
+	start := int(loc["start"].(float64))
+	if len(code) == 0 || start > len(code) {
+		return fmt.Sprintf("%v@%d", loc["filename"], start)
+	}
+	line, col := lineCol(code, start)
+	return fmt.Sprintf("%v:%d:%d", loc["filename"], line, col)
 }
@@ -0,0 +1,231 @@
+package interpreter
+
+// Effect classifica o que uma função faz além de calcular o resultado
+type Effect uint8
+
+const (
+	EffectPure          Effect = iota // o resultado depende só dos argumentos
+	EffectReadsCaptures               // também lê variáveis capturadas, imutáveis em cada closure
+	EffectEffectful                   // print ou chamada a uma closure desconhecida
+)
+
+var effectNames = []string{
+	EffectPure:          "pure",
+	EffectReadsCaptures: "reads-captures",
+	EffectEffectful:     "effectful",
+}
+
+func (e Effect) String() string {
+	return effectNames[e]
+}
+
+// FunctionEffect é o resultado da análise para um nó Function, guardado
+// no campo "effect" do nó
+type FunctionEffect struct {
+	Effect Effect
+	// MemoSafe indica que a memoização só pelos argumentos é segura: a função
+	// não tem efeitos e, se lê capturas, elas vêm do root e são as mesmas
+	// para qualquer instância da closure. Funções sem efeito com capturas
+	// locais também são memoizadas, mas com as capturas na chave.
+	MemoSafe bool
+
+	localCaptures bool
+	callsUnknown  bool              // chama closures que não são conhecidas no build
+	escapes       bool              // a closure é usada como valor, não só chamada pelo nome
+	calls         []*FunctionEffect // funções conhecidas que ela pode chamar
+}
+
+// effectBinding liga um nome ao que a análise sabe sobre ele
+type effectBinding struct {
+	name   string
+	owner  *FunctionEffect // função onde o nome foi definido; nil no root
+	fn     *FunctionEffect // o nome é um let de uma função conhecida
+	parent *effectBinding
+}
+
+func (self *effectBinding) lookup(name string) *effectBinding {
+	for b := self; b != nil; b = b.parent {
+		if b.name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// AnalyzeEffects anota cada nó Function com seu FunctionEffect.
+//
+// Toda closure nasce de um nó Function. Se nenhuma função com efeito é
+// usada como valor (passada como argumento, guardada numa tupla,
+// retornada), chamar uma closure desconhecida não pode causar efeito. Do
+// contrário, essas chamadas são tratadas como efeito.
+func AnalyzeEffects(ast map[string]interface{}) map[string]interface{} {
+	a := &effectAnalysis{}
+	var result map[string]interface{}
+	if ast["expression"] == nil {
+		result = a.term(ast, nil, nil)
+	} else {
+		result = with(ast, "expression", a.term(ast["expression"].(map[string]interface{}), nil, nil))
+	}
+
+	for changed := true; changed; {
+		changed = false
+		unknownEffect := a.forwardValues
+		for _, fn := range a.functions {
+			unknownEffect = unknownEffect || (fn.escapes && fn.Effect == EffectEffectful)
+		}
+		for _, fn := range a.functions {
+			if fn.Effect == EffectEffectful {
+				continue
+			}
+			effectful := fn.callsUnknown && unknownEffect
+			for _, callee := range fn.calls {
+				effectful = effectful || callee.Effect == EffectEffectful
+			}
+			if effectful {
+				fn.Effect = EffectEffectful
+				changed = true
+			}
+		}
+	}
+	for _, fn := range a.functions {
+		fn.MemoSafe = fn.Effect == EffectPure || (fn.Effect == EffectReadsCaptures && !fn.localCaptures)
+	}
+	return result
+}
+
+type effectAnalysis struct {
+	functions []*FunctionEffect
+
+	// uma função usa como valor um let definido depois dela, que pode ser
+	// uma closure com efeito
+	forwardValues bool
+}
+
+func (self *effectAnalysis) term(term map[string]interface{}, env *effectBinding, fn *FunctionEffect) map[string]interface{} {
+	child := func(key string) map[string]interface{} {
+		return self.term(term[key].(map[string]interface{}), env, fn)
+	}
+
+	switch term["kind"] {
+	case "Var":
+		name := term["text"].(string)
+		if b := self.read(name, env, fn); b != nil && b.fn != nil {
+			b.fn.escapes = true
+		} else if b == nil && fn != nil && !builtin(name) {
+			self.forwardValues = true
+		}
+
+	case "Print":
+		self.raise(fn, EffectEffectful)
+		return with(term, "value", child("value"))
+
+	case "Let":
+		name := term["name"].(map[string]interface{})["text"].(string)
+		value := term["value"].(map[string]interface{})
+		b := &effectBinding{name: name, owner: fn, parent: env}
+		if value["kind"] == "Function" {
+			// visível dentro da função para permitir recursão
+			b.fn = &FunctionEffect{}
+			value = self.function(value, b, b.fn)
+		} else {
+			value = self.term(value, env, fn)
+		}
+		return with(with(term, "value", value), "next", self.term(term["next"].(map[string]interface{}), b, fn))
+
+	case "Function":
+		info := &FunctionEffect{escapes: true}
+		return self.function(term, env, info)
+
+	case "Call":
+		callee := term["callee"].(map[string]interface{})
+		switch callee["kind"] {
+		case "Function":
+			callee = self.function(callee, env, &FunctionEffect{})
+			self.depends(fn, callee["effect"].(*FunctionEffect))
+		case "Var":
+			name := callee["text"].(string)
+			b := self.read(name, env, fn)
+			switch {
+			case b != nil && b.fn != nil:
+				self.depends(fn, b.fn)
+			case b == nil && builtin(name):
+			default:
+				self.callsUnknown(fn)
+			}
+		default:
+			callee = self.term(callee, env, fn)
+			self.callsUnknown(fn)
+		}
+		args := make([]interface{}, len(term["arguments"].([]interface{})))
+		for i, a := range term["arguments"].([]interface{}) {
+			args[i] = self.term(a.(map[string]interface{}), env, fn)
+		}
+		return with(with(term, "callee", callee), "arguments", args)
+
+	case "If":
+		return with(with(with(term, "condition", child("condition")), "then", child("then")), "otherwise", child("otherwise"))
+
+	case "Tuple":
+		return with(with(term, "first", child("first")), "second", child("second"))
+
+	case "First", "Second", "Unary":
+		return with(term, "value", child("value"))
+
+	case "Binary":
+		return with(with(term, "lhs", child("lhs")), "rhs", child("rhs"))
+	}
+	return term
+}
+
+// function analisa o corpo de uma função; env já inclui o nome do let
+// dono, se houver
+func (self *effectAnalysis) function(term map[string]interface{}, env *effectBinding, info *FunctionEffect) map[string]interface{} {
+	self.functions = append(self.functions, info)
+	for _, p := range term["parameters"].([]interface{}) {
+		env = &effectBinding{name: p.(map[string]interface{})["text"].(string), owner: info, parent: env}
+	}
+	body := self.term(term["value"].(map[string]interface{}), env, info)
+	return with(with(term, "value", body), "effect", info)
+}
+
+// read registra a leitura de uma variável: se ela vem de fora da função
+// em análise, é uma captura
+func (self *effectAnalysis) read(name string, env *effectBinding, fn *FunctionEffect) *effectBinding {
+	b := env.lookup(name)
+	if b == nil && fn != nil && !builtin(name) {
+		// um let definido depois da função, que a análise ainda não viu
+		self.raise(fn, EffectEffectful)
+		return nil
+	}
+	if fn == nil || b == nil || b.owner == fn || b.fn == fn {
+		return b // root, variável inexistente (erro em runtime), local ou a própria função
+	}
+	self.raise(fn, EffectReadsCaptures)
+	if b.owner != nil {
+		fn.localCaptures = true
+	}
+	return b
+}
+
+// builtin indica as funções da linguagem, que não têm efeito
+func builtin(name string) bool {
+	return name == "to_int" || name == "to_float"
+}
+
+func (self *effectAnalysis) callsUnknown(fn *FunctionEffect) {
+	if fn != nil {
+		fn.callsUnknown = true
+	}
+}
+
+func (self *effectAnalysis) depends(fn, callee *FunctionEffect) {
+	if fn != nil {
+		fn.calls = append(fn.calls, callee)
+	}
+}
+
+func (self *effectAnalysis) raise(fn *FunctionEffect, e Effect) {
+	if fn != nil && fn.Effect < e {
+		fn.Effect = e
+	}
+}
@@ -0,0 +1,106 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+// effects devolve o resultado da análise para cada função nomeada por um let
+func effects(t *testing.T, src string) map[string]*FunctionEffect {
+	t.Helper()
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	found := map[string]*FunctionEffect{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if x["kind"] == "Let" {
+				if fn, ok := x["value"].(map[string]interface{})["effect"].(*FunctionEffect); ok {
+					found[x["name"].(map[string]interface{})["text"].(string)] = fn
+				}
+			}
+			for k, c := range x {
+				if k != "effect" {
+					walk(c)
+				}
+			}
+		case []interface{}:
+			for _, c := range x {
+				walk(c)
+			}
+		}
+	}
+	walk(AnalyzeEffects(ast))
+	return found
+}
+
+func TestEffects(t *testing.T) {
+	tests := []struct {
+		src  string
+		name string
+		want Effect
+		memo bool
+	}{
+		{`let f = fn (n) => if (n < 2) { n } else { f(n - 1) + f(n - 2) }; f(10)`, "f", EffectPure, true},
+		{`let k = 10; let f = fn (n) => n + k; f(1)`, "f", EffectReadsCaptures, true},
+		{`let g = fn (x) => x * 2; let f = fn (n) => g(n) + 1; f(1)`, "f", EffectReadsCaptures, true},
+		{`let f = fn (n) => { let _ = print(n); n }; f(1)`, "f", EffectEffectful, false},
+		{`let p = fn (x) => print(x); let f = fn (n) => p(n); f(1)`, "f", EffectEffectful, false},
+		{`let f = fn (n) => { let g = fn (x) => n + x; g(1) }; f(1)`, "g", EffectReadsCaptures, false},
+		{`let f = fn (n) => { let g = fn (x) => n + x; g(1) }; f(1)`, "f", EffectPure, true},
+		{`let f = fn (n) => { let g = fn (x) => print(x); g(n) }; f(1)`, "f", EffectEffectful, false},
+		// chamadas a closures desconhecidas só têm efeito se alguma função
+		// com efeito é usada como valor
+		{`let f = fn (g, n) => g(n); f(fn (x) => x, 1)`, "f", EffectPure, true},
+		{`let f = fn (g, n) => g(n); f(fn (x) => print(x), 1)`, "f", EffectEffectful, false},
+		{`let p = fn (x) => print(x); let t = (p, 1); let f = fn (g, n) => g(n); f(first(t), 1)`, "f", EffectEffectful, false},
+		{`let mk = fn () => fn (x) => print(x); let f = fn (n) => mk()(n); f(1)`, "f", EffectEffectful, false},
+		{`let mk = fn () => fn (x) => x; let f = fn (n) => mk()(n); f(1)`, "f", EffectReadsCaptures, true},
+		// uma função que apenas chama outra com efeito pelo nome não a torna um valor
+		{`let p = fn (x) => print(x); let f = fn (g, n) => g(n); let _ = p(1); f(fn (x) => x, 1)`, "f", EffectPure, true},
+		// lets definidos depois da função ainda não são conhecidos
+		{`let f = fn (n) => g(n); let g = fn (n) => print(n); f(1)`, "f", EffectEffectful, false},
+		{`let f = fn (n) => g; let g = fn (n) => print(n); let h = fn (k, n) => k(n); h(f(1), 1)`, "h", EffectEffectful, false},
+		{`let f = fn (n) => to_int(n); f(1.5)`, "f", EffectPure, true},
+	}
+	for _, tt := range tests {
+		fn := effects(t, tt.src)[tt.name]
+		if fn == nil {
+			t.Fatalf("%s: function %s not found", tt.src, tt.name)
+		}
+		if fn.Effect != tt.want || fn.MemoSafe != tt.memo {
+			t.Errorf("%s: %s is %s (memo %v), want %s (memo %v)", tt.src, tt.name, fn.Effect, fn.MemoSafe, tt.want, tt.memo)
+		}
+	}
+}
+
+func TestEffectsMemoization(t *testing.T) {
+	// a captura de uma constante do root não impede a memoização
+	if got := run(t, `let one = 1; let f = fn (n) => if (n == 0) { one } else { f(n - 1) + f(n - 1) }; f(60)`); got.String() != "1152921504606846976" {
+		t.Errorf("got %s", got)
+	}
+
+	// closures locais com capturas diferentes compartilham o mesmo código,
+	// mas não a cache
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let mk = fn (k) => { let f = fn (n) => n + k; f }; let a = mk(1); let b = mk(2); let _ = print(a(1)); print(b(1))`, "2 3"},
+		{`let f = fn (n) => { let _ = print(n); n }; let _ = f(1); f(1)`, "1 1"},
+	}
+	for _, tt := range tests {
+		ast, err := Parse("test.rinha", tt.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		var out strings.Builder
+		BuildAst("", ast, Options{Output: &out})()
+		if got := strings.Join(strings.Fields(out.String()), " "); got != tt.want {
+			t.Errorf("%s printed %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package interpreter
+
+// constEnv liga nomes de let a literais conhecidos em tempo de build.
+// Um valor nil indica que o nome foi sombreado por algo não constante.
+type constEnv struct {
+	name   string
+	value  map[string]interface{}
+	parent *constEnv
+}
+
+func (self *constEnv) lookup(name string) map[string]interface{} {
+	for e := self; e != nil; e = e.parent {
+		if e.name == name {
+			return e.value
+		}
+	}
+	return nil
+}
+
+func (self *constEnv) bind(name string, value map[string]interface{}) *constEnv {
+	return &constEnv{name: name, value: value, parent: self}
+}
+
+// Fold é a passada de otimização pré-runtime: dobra operações entre
+// literais, projeções de tuplas literais e ifs com condição constante, e
+// propaga lets constantes. Os nós gerados mantêm a localização original
+// para que erros em runtime continuem apontando para o trecho certo.
+//
+// Inteiros só são dobrados quando operandos e resultado cabem no modelo
+// de inteiros escolhido, onde todos os modelos concordam.
+func Fold(ast map[string]interface{}, mode IntMode) map[string]interface{} {
+	f := folder{ints: mode.ops()}
+	if ast["expression"] == nil {
+		return f.fold(ast, nil)
+	}
+	return with(ast, "expression", f.fold(ast["expression"].(map[string]interface{}), nil))
+}
+
+type folder struct {
+	ints intOps
+}
+
+func (self folder) fold(term map[string]interface{}, env *constEnv) map[string]interface{} {
+	child := func(key string) map[string]interface{} {
+		return self.fold(term[key].(map[string]interface{}), env)
+	}
+
+	switch term["kind"] {
+	case "Var":
+		if lit := env.lookup(term["text"].(string)); lit != nil {
+			return with(lit, "location", term["location"])
+		}
+
+	case "Let":
+		name := term["name"].(map[string]interface{})["text"].(string)
+		value := term["value"].(map[string]interface{})
+		if value["kind"] != "Function" {
+			value = self.fold(value, env)
+		}
+		if isScalarLiteral(value) {
+			env = env.bind(name, value)
+		} else {
+			env = env.bind(name, nil)
+			if value["kind"] == "Function" {
+				value = self.fold(value, env)
+			}
+		}
+		return with(with(term, "value", value), "next", self.fold(term["next"].(map[string]interface{}), env))
+
+	case "Function":
+		for _, p := range term["parameters"].([]interface{}) {
+			env = env.bind(p.(map[string]interface{})["text"].(string), nil)
+		}
+		return with(term, "value", self.fold(term["value"].(map[string]interface{}), env))
+
+	case "If":
+		condition := child("condition")
+		if condition["kind"] == "Bool" {
+			if condition["value"].(bool) {
+				return child("then")
+			}
+			return child("otherwise")
+		}
+		return with(with(with(term, "condition", condition), "then", child("then")), "otherwise", child("otherwise"))
+
+	case "Tuple":
+		return with(with(term, "first", child("first")), "second", child("second"))
+
+	case "First", "Second":
+		tuple := child("value")
+		if tuple["kind"] == "Tuple" && isConstant(tuple) {
+			if term["kind"] == "First" {
+				return with(tuple["first"].(map[string]interface{}), "location", term["location"])
+			}
+			return with(tuple["second"].(map[string]interface{}), "location", term["location"])
+		}
+		return with(term, "value", tuple)
+
+	case "Call":
+		args := make([]interface{}, len(term["arguments"].([]interface{})))
+		for i, a := range term["arguments"].([]interface{}) {
+			args[i] = self.fold(a.(map[string]interface{}), env)
+		}
+		return with(with(term, "callee", child("callee")), "arguments", args)
+
+	case "Print":
+		return with(term, "value", child("value"))
+
+	case "Unary":
+		value := child("value")
+		switch {
+		case term["op"] == "Not" && value["kind"] == "Bool":
+			return map[string]interface{}{"kind": "Bool", "value": !value["value"].(bool), "location": term["location"]}
+		case term["op"] == "Neg" && value["kind"] == "Float":
+			return map[string]interface{}{"kind": "Float", "value": -value["value"].(float64), "location": term["location"]}
+		case term["op"] == "Neg" && value["kind"] == "Int":
+			inRange := func(v int64) bool { return v >= self.ints.min && v <= self.ints.max }
+			if v, ok := subInt64(0, intLiteral(value["value"])); ok && inRange(-v) && inRange(v) {
+				return map[string]interface{}{"kind": "Int", "value": v, "location": term["location"]}
+			}
+		}
+		return with(term, "value", value)
+
+	case "Binary":
+		lhs := child("lhs")
+		// curto-circuito: o rhs não seria avaliado
+		if op := term["op"]; lhs["kind"] == "Bool" && (op == "And" || op == "Or") && lhs["value"] == (op == "Or") {
+			return with(lhs, "location", term["location"])
+		}
+		rhs := child("rhs")
+		if isScalarLiteral(lhs) && isScalarLiteral(rhs) {
+			if kind, value, ok := self.foldBinary(term["op"].(string), lhs, rhs); ok {
+				return map[string]interface{}{"kind": kind, "value": value, "location": term["location"]}
+			}
+		}
+		return with(with(term, "lhs", lhs), "rhs", rhs)
+	}
+	return term
+}
+
+// foldBinary calcula a operação entre dois literais. Casos que o runtime
+// trataria de forma especial (overflow, divisão por zero, tipos inválidos)
+// não são dobrados e ficam para o runtime.
+func (self folder) foldBinary(op string, lhs, rhs map[string]interface{}) (kind string, value interface{}, ok bool) {
+	inRange := func(v int64) bool { return v >= self.ints.min && v <= self.ints.max }
+	switch {
+	case lhs["kind"] == "Int" && rhs["kind"] == "Int":
+		l, r := intLiteral(lhs["value"]), intLiteral(rhs["value"])
+		if !inRange(l) || !inRange(r) {
+			return
+		}
+		switch op {
+		case "Add", "Sub", "Mul":
+			calc := map[string]func(l, r int64) (int64, bool){"Add": addInt64, "Sub": subInt64, "Mul": mulInt64}[op]
+			if v, ok := calc(l, r); ok && inRange(v) {
+				return "Int", v, true
+			}
+		case "Div", "Rem":
+			if r == 0 {
+				return
+			}
+			if op == "Rem" {
+				return "Int", remInt64(l, r), true
+			}
+			if v, ok := divInt64(l, r); ok && inRange(v) {
+				return "Int", v, true
+			}
+		case "Lt":
+			return "Bool", l < r, true
+		case "Lte":
+			return "Bool", l <= r, true
+		case "Gt":
+			return "Bool", l > r, true
+		case "Gte":
+			return "Bool", l >= r, true
+		case "Eq":
+			return "Bool", l == r, true
+		case "Neq":
+			return "Bool", l != r, true
+		}
+
+	case op == "Add" && (lhs["kind"] == "Str" || rhs["kind"] == "Str") && lhs["kind"] != "Bool" && rhs["kind"] != "Bool":
+		return "Str", self.literalText(lhs) + self.literalText(rhs), true
+
+	case isNumberLiteral(lhs) && isNumberLiteral(rhs):
+		l, r := self.number(lhs), self.number(rhs)
+		numeric := self.ints.numeric()
+		if calc, h := map[string]numericOp{"Add": numeric.add, "Sub": numeric.sub, "Mul": numeric.mul, "Div": numeric.div, "Rem": numeric.rem}[op]; h {
+			if v, err := calc.apply(l, r); err == nil {
+				return "Float", v.Float(), true
+			}
+			return
+		}
+		c := compareNumbers(l, r)
+		switch op {
+		case "Lt":
+			return "Bool", c == -1, true
+		case "Lte":
+			return "Bool", c == -1 || c == 0, true
+		case "Gt":
+			return "Bool", c == 1, true
+		case "Gte":
+			return "Bool", c == 1 || c == 0, true
+		case "Eq":
+			return "Bool", c == 0, true
+		case "Neq":
+			return "Bool", c != 0, true
+		}
+
+	case lhs["kind"] == "Str" && rhs["kind"] == "Str":
+		l, r := lhs["value"].(string), rhs["value"].(string)
+		switch op {
+		case "Eq":
+			return "Bool", l == r, true
+		case "Neq":
+			return "Bool", l != r, true
+		case "Lt":
+			return "Bool", l < r, true
+		case "Lte":
+			return "Bool", l <= r, true
+		case "Gt":
+			return "Bool", l > r, true
+		case "Gte":
+			return "Bool", l >= r, true
+		}
+
+	case lhs["kind"] == "Bool" && rhs["kind"] == "Bool":
+		l, r := lhs["value"].(bool), rhs["value"].(bool)
+		switch op {
+		case "Eq":
+			return "Bool", l == r, true
+		case "Neq":
+			return "Bool", l != r, true
+		case "And":
+			return "Bool", l && r, true
+		case "Or":
+			return "Bool", l || r, true
+		}
+	}
+	return
+}
+
+// with retorna uma cópia rasa de term com key alterada
+func with(term map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	node := make(map[string]interface{}, len(term))
+	for k, v := range term {
+		node[k] = v
+	}
+	node[key] = value
+	return node
+}
+
+func isScalarLiteral(term map[string]interface{}) bool {
+	switch term["kind"] {
+	case "Int", "Float", "Str", "Bool":
+		return true
+	}
+	return false
+}
+
+func isNumberLiteral(term map[string]interface{}) bool {
+	return term["kind"] == "Int" || term["kind"] == "Float"
+}
+
+// number converte um literal numérico como o runtime faria no modelo atual
+func (self folder) number(term map[string]interface{}) Value {
+	if term["kind"] == "Float" {
+		return Float(term["value"].(float64))
+	}
+	return self.ints.literal(intLiteral(term["value"]))
+}
+
+func isConstant(term map[string]interface{}) bool {
+	if term["kind"] == "Tuple" {
+		return isConstant(term["first"].(map[string]interface{})) && isConstant(term["second"].(map[string]interface{}))
+	}
+	return isScalarLiteral(term)
+}
+
+// intLiteral lê o valor de um literal Int, vindo do json (float64) ou da
+// passada de otimização (int64)
+func intLiteral(v interface{}) int64 {
+	if i, ok := v.(int64); ok {
+		return i
+	}
+	return int64(v.(float64))
+}
+
+func (self folder) literalText(term map[string]interface{}) string {
+	if isNumberLiteral(term) {
+		return self.number(term).String()
+	}
+	return term["value"].(string)
+}
@@ -3,6 +3,7 @@ package interpreter
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
@@ -22,3 +23,292 @@ func TestExamples(t *testing.T) {
 		fmt.Println()
 	}
 }
+
+func benchmarkExample(b *testing.B, file string) {
+	prog := Build("../examples/" + file)
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout = stdout }()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prog()
+	}
+}
+
+func BenchmarkSum(b *testing.B)         { benchmarkExample(b, "sum.json") }
+func BenchmarkFactorial(b *testing.B)   { benchmarkExample(b, "factorial.json") }
+func BenchmarkCombination(b *testing.B) { benchmarkExample(b, "combination.json") }
+func BenchmarkFibFn(b *testing.B)       { benchmarkExample(b, "fib-fn.json") }
+func BenchmarkFib(b *testing.B)         { benchmarkExample(b, "fib.json") }
+func BenchmarkHanoi(b *testing.B)       { benchmarkExample(b, "hanoi.json") }
+
+func field(term map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		term = term[key].(map[string]interface{})
+	}
+	return term
+}
+
+func TestFold(t *testing.T) {
+	_, ast := LoadAst("../examples/fib-linear.json")
+	rhs := field(Fold(ast, IntModeBigInt), "expression", "next", "next", "value", "condition", "rhs")
+	if rhs["kind"] != "Int" || rhs["value"] != int64(12586269025) {
+		t.Fatalf("1258626902 * 10 + 5 not folded: %v", rhs)
+	}
+	if loc := field(rhs, "location"); loc["start"] != float64(181) {
+		t.Fatalf("folded node lost its location: %v", loc)
+	}
+}
+
+func eval(t *testing.T, expression string) Value {
+	t.Helper()
+	ast := ParseAst([]byte(`{"name": "test", "expression": ` + expression + `}`))
+	if ast["expression"] == nil {
+		t.Fatalf("invalid test AST: %s", expression)
+	}
+	return BuildAst("", ast, Options{})()
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+		kind       Kind
+	}{
+		{`{"kind": "Binary", "op": "Add", "lhs": {"kind": "Int", "value": 1}, "rhs": {"kind": "Float", "value": 0.5}}`, "1.5", KindFloat},
+		{`{"kind": "Binary", "op": "Div", "lhs": {"kind": "Int", "value": 7}, "rhs": {"kind": "Float", "value": 2}}`, "3.5", KindFloat},
+		{`{"kind": "Binary", "op": "Rem", "lhs": {"kind": "Float", "value": -7.5}, "rhs": {"kind": "Int", "value": 2}}`, "-1.5", KindFloat},
+		{`{"kind": "Binary", "op": "Eq", "lhs": {"kind": "Int", "value": 1}, "rhs": {"kind": "Float", "value": 1}}`, "true", KindBool},
+		{`{"kind": "Binary", "op": "Lt", "lhs": {"kind": "Float", "value": 2.5}, "rhs": {"kind": "Int", "value": 2}}`, "false", KindBool},
+		{`{"kind": "Binary", "op": "Add", "lhs": {"kind": "Str", "value": "x"}, "rhs": {"kind": "Float", "value": 2}}`, "x2.0", KindStr},
+		{`{"kind": "Call", "callee": {"kind": "Var", "text": "to_int"}, "arguments": [{"kind": "Float", "value": -3.7}]}`, "-3", KindInt},
+		{`{"kind": "Call", "callee": {"kind": "Var", "text": "to_int"}, "arguments": [{"kind": "Float", "value": 1e20}]}`, "100000000000000000000", KindBigInt},
+		{`{"kind": "Call", "callee": {"kind": "Var", "text": "to_float"}, "arguments": [{"kind": "Int", "value": 3}]}`, "3.0", KindFloat},
+		{`{"kind": "Let", "name": {"text": "to_float"}, "value": {"kind": "Function", "parameters": [{"text": "x"}], "value": {"kind": "Str", "value": "mine"}},
+			"next": {"kind": "Call", "callee": {"kind": "Var", "text": "to_float"}, "arguments": [{"kind": "Int", "value": 3}]}}`, "mine", KindStr},
+	}
+	for _, tt := range tests {
+		if got := eval(t, tt.expression); got.String() != tt.want || got.kind != tt.kind {
+			t.Errorf("%s = %s (kind %d), want %s (kind %d)", tt.expression, got, got.kind, tt.want, tt.kind)
+		}
+	}
+
+	// NaN não é ordenado nem igual a nada, nem a si mesmo; os literais são
+	// calculados pelo Fold, as variáveis em runtime
+	comparisons := []struct {
+		op   string
+		want bool
+	}{{"==", false}, {"!=", true}, {"<", false}, {"<=", false}, {">", false}, {">=", false}}
+	for _, c := range comparisons {
+		for _, src := range []string{
+			"let inf = 1e308 * 10.0; let nan = inf - inf; nan " + c.op + " nan",
+			"let inf = 1e308 * 10.0; let nan = inf - inf; nan " + c.op + " 0",
+			"let inf = 1e308 * 10.0; let nan = inf - inf; 1.5 " + c.op + " nan",
+			"(1e308 * 10.0 - 1e308 * 10.0) " + c.op + " 0",
+		} {
+			if got := run(t, src); got.String() != fmt.Sprint(c.want) {
+				t.Errorf("%s = %s", src, got)
+			}
+		}
+	}
+	if got := run(t, "let inf = 1e308 * 10.0; let nan = inf - inf; (nan, 1) == (nan, 1)"); got.String() != "false" {
+		t.Errorf("tuples with NaN compared as equal")
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// sem curto-circuito a recursão não termina
+		{`let f = fn (n) => n == 0 || f(n - 1); f(3)`, "true"},
+		{`let f = fn (n) => n > 0 && f(n - 1); f(3)`, "false"},
+		{`let t = true; t || 1`, "true"},
+		{`let f = false; f && "x"`, "false"},
+		{`let t = true; t && false || t`, "true"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	ast, _ := Parse("test.rinha", `false && print(1)`)
+	if lit := field(Fold(ast, IntModeBigInt), "expression"); lit["kind"] != "Bool" || lit["value"] != false {
+		t.Errorf("false && ... not folded: %v", lit)
+	}
+}
+
+// Cada print registra a ordem em que os nós foram avaliados
+func TestEvaluationOrder(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let f = fn (x) => x + 1; f(print(1)) + f(print(2))`, "1 2"}, // função memoizada
+		{`let f = fn (a, b) => a; f(print(1), print(2))`, "1 2"},
+		{`let f = fn (x) => { let _ = print(x); x }; f(print(1))`, "1 1"},
+		{`let g = fn () => { let _ = print("callee"); fn (x) => x }; g()(print("arg"))`, "callee arg"},
+		{`let x = print(1); print(2)`, "1 2"},
+		{`print(print(1) + print(2) * print(3))`, "1 2 3 7"},
+		{`(print(1), print(2))`, "1 2"},
+		{`first((print(1), print(2)))`, "1 2"},
+		{`if (print(true)) { print(1) } else { print(2) }`, "true 1"},
+		{`print(false) && print(true)`, "false"},
+		{`!print(true)`, "true"},
+	}
+	for _, tt := range tests {
+		ast, err := Parse("test.rinha", tt.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		var out strings.Builder
+		BuildAst(tt.src, ast, Options{Output: &out})()
+		if got := strings.Join(strings.Fields(out.String()), " "); got != tt.want {
+			t.Errorf("%s printed %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let a = "abc"; a < "abd"`, "true"},
+		{`let a = "ab"; a < "abc"`, "true"},
+		{`let a = "b"; a >= "abc"`, "true"},
+		{`let t = (1, (2, "x")); t == (1, (2, "x"))`, "true"},
+		{`let t = (1, (2, "x")); t != (1, (2, "y"))`, "true"},
+		{`let t = (1, 2); t == (1.0, 2)`, "true"},
+		{`let t = (9223372036854775807 + 1, 2); t == (9223372036854775807 + 1, 2)`, "true"},
+		{`let t = (1, "b"); t < (1, "c")`, "true"},
+		{`let t = (2, "a"); t > (1, "z")`, "true"},
+		{`let t = (true, 1); t == (true, 1)`, "true"},
+		{`let f = fn () => 1; let g = f; f == g`, "true"},
+		{`let f = fn () => 1; f == fn () => 1`, "false"},
+		{`let mk = fn () => fn () => 1; mk() != mk()`, "true"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	// lista longa encadeada em tuplas
+	list, other := Int(0), Int(0)
+	for i := 0; i < 1000000; i++ {
+		list, other = NewTuple(Int(int64(i)), list), NewTuple(Int(int64(i)), other)
+	}
+	if c, _, ok := compareValues(list, other, true); !ok || c != 0 {
+		t.Errorf("equal lists compared as %d (%v)", c, ok)
+	}
+
+	mismatches := []struct {
+		l, r    Value
+		ordered bool
+		bad     [2]Kind
+	}{
+		{Str("a"), Int(1), false, [2]Kind{KindStr, KindInt}},
+		{Bool(true), Bool(false), true, [2]Kind{KindBool, KindBool}},
+		{NewTuple(Int(1), Str("a")), NewTuple(Int(1), Int(2)), false, [2]Kind{KindStr, KindInt}},
+		{NewTuple(Int(1), Int(2)), Int(1), false, [2]Kind{KindTuple, KindInt}},
+	}
+	for _, tt := range mismatches {
+		if _, bad, ok := compareValues(tt.l, tt.r, tt.ordered); ok || bad != tt.bad {
+			t.Errorf("compare %s with %s: got %v %v, want mismatch %v", tt.l, tt.r, bad, ok, tt.bad)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`let f = (fn () => { fn (x) => { if (x == 0) { 0 } else { 1 + f(x - 1) } } })(); f(3)`, "3"},
+		{`let g = fn (c) => { let f = if (c) { fn (x) => { if (x == 0) { 0 } else { 1 + f(x - 1) } } } else { fn (x) => x }; f(3) }; g(true)`, "3"},
+		{`let f = (fn () => fn () => fn (x) => if (x == 0) { 0 } else { 1 + f(x - 1) })()(); f(4)`, "4"},
+		{`let p = (fn (x) => if (x == 0) { 0 } else { 1 + first(p)(x - 1) }, 0); first(p)(5)`, "5"},
+		// fora das funções o nome ainda é o binding anterior
+		{`let x = 1; let x = x + 1; x`, "2"},
+		{`let f = fn (x) => x * 10; let f = f(2) + 1; f`, "21"},
+		{`let f = fn (x) => 0; let g = (fn () => fn (x) => if (x == 0) { 0 } else { 1 + f(x - 1) })(); g(3)`, "1"},
+		{`let x = (1, 2); let x = (fn () => first(x))(); x`, "1"},
+		{`let x = 5; let x = (fn () => fn () => x)(); x()`, "5"},
+		// funções podem usar lets definidos depois delas
+		{`let f = fn (n) => if (n == 0) { 0 } else { g(n - 1) }; let g = fn (n) => if (n == 0) { 1 } else { f(n - 1) }; f(5)`, "1"},
+		{`let h = fn (k) => { let even = fn (n) => if (n == 0) { true } else { odd(n - 1) }; let odd = fn (n) => if (n == 0) { false } else { even(n - 1) }; even(k) }; h(7)`, "false"},
+		{`let a = { let h = fn () => k(); let k = fn () => 7; h() }; let k = fn () => 8; a`, "7"},
+		{`let f = fn () => v; let v = (1, 2); second(f())`, "2"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	// usar o let antes de ele ser atribuído continua sendo um erro
+	for _, src := range []string{
+		`let a = g(1); let g = fn (x) => x; a`,
+		`let f = fn () => g(); let _ = f(); let g = fn () => 1; 0`,
+	} {
+		if out := runError(t, src); !strings.Contains(out, "var not found") {
+			t.Errorf("%s: %q", src, out)
+		}
+	}
+}
+
+// runError executa src num subprocesso do teste, já que um erro de runtime
+// encerra o programa, e retorna a mensagem escrita
+func runError(t *testing.T, src string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunError$")
+	cmd.Env = append(os.Environ(), "RINHA_TEST_SOURCE="+src)
+	out, err := cmd.Output()
+	if err == nil {
+		t.Errorf("%s: no runtime error", src)
+	}
+	return string(out)
+}
+
+func TestRunError(t *testing.T) {
+	if src := os.Getenv("RINHA_TEST_SOURCE"); src != "" {
+		run(t, src)
+	}
+}
+
+func TestStaticCalls(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// o let mais recente no ponto da chamada
+		{`let f = fn (x) => 1; let g = fn (x) => f(x); let f = fn (x) => 2; g(0) + f(0) * 10`, "21"},
+		{`let f = fn (x) => 1; let h = fn () => { let f = fn (x) => 2; f(0) }; h() + f(0) * 10`, "12"},
+		{`let f = fn (x) => 1; let g = fn (f) => f(0); g(fn (x) => 3)`, "3"},
+		// funções capturadas
+		{`let sq = fn (x) => x * x; let mk = fn () => fn (y) => sq(y) + 1; mk()(3)`, "10"},
+		{`let sq = fn (x) => x * x; let mk = fn () => { let sq = fn (x) => x; fn (y) => sq(y) }; mk()(3)`, "3"},
+		{`let sq = fn (x) => x * x; let mk = fn () => fn () => fn (y) => sq(y); mk()()(4)`, "16"},
+		// a aridade errada só é um erro se a chamada é executada
+		{`let f = fn (x) => x; if (false) { f(1, 2) } else { 7 }`, "7"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{
+		`let f = fn (x) => x; f(1, 2)`,
+		`let f = fn (x, y) => x; let g = fn () => f(1); g()`,
+		`let f = fn (x) => x; let f = fn (x, y) => x; f(1)`,
+	} {
+		if out := runError(t, src); !strings.Contains(out, "Wrong number of arguments") {
+			t.Errorf("%s: %q", src, out)
+		}
+	}
+}
@@ -1,11 +1,532 @@
 package interpreter
 
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"text/tabwriter"
+	"unsafe"
+)
+
 const (
+	// MemoizeCacheLimit é o limite padrão de entradas por função
 	MemoizeCacheLimit = 200
+
+	// custo estimado de uma entrada, além da chave e do valor
+	memoEntryOverhead = 96
+
+	// chamadas com chaves maiores que isso (listas longas, por exemplo)
+	// não passam pela cache
+	memoKeyLimit = 4096
+
+	// chamadas com até esse número de argumentos, todos int64, usam
+	// memoIntKey em vez da codificação em bytes
+	memoIntArity = 3
+)
+
+// ------------------- políticas
+
+type MemoPolicy uint8
+
+const (
+	MemoLRU       MemoPolicy = iota // descarta a entrada usada há mais tempo
+	MemoLFU                         // descarta a entrada menos usada
+	MemoUnbounded                   // sem limite por função, nada é descartado
+	MemoOff                         // sem memoização
 )
 
+var memoPolicyNames = []string{
+	MemoLRU:       "lru",
+	MemoLFU:       "lfu",
+	MemoUnbounded: "unbounded",
+	MemoOff:       "off",
+}
+
+func (p MemoPolicy) String() string {
+	return memoPolicyNames[p]
+}
+
+func ParseMemoPolicy(name string) (MemoPolicy, error) {
+	for p, n := range memoPolicyNames {
+		if n == name {
+			return MemoPolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown memo policy %q (expected lru, lfu, unbounded or off)", name)
+}
+
+// MemoOptions configura a memoização. O valor zero é LRU com
+// MemoizeCacheLimit entradas por função e sem limites globais.
+type MemoOptions struct {
+	Policy         MemoPolicy
+	MaxEntries     int   // entradas por função; 0 usa MemoizeCacheLimit
+	ProgramEntries int   // entradas somando todas as funções; 0 é sem limite
+	MaxBytes       int64 // memória estimada somando todas as funções; 0 é sem limite
+
+	// MissLimit desliga a cache de uma função quando ela, cheia, passa
+	// esse número de consultas seguidas sem acerto: a função não se
+	// beneficia de memoização. 0, o padrão, nunca desliga: com descarte,
+	// a cache cheia ainda pode voltar a acertar.
+	MissLimit int
+
+	// Stats recebe, ao fim da execução, uma tabela com o uso da cache de
+	// cada função nomeada
+	Stats io.Writer
+
+	// Store é o arquivo onde os resultados são guardados entre execuções;
+	// vazio desliga
+	Store string
+}
+
+// memoBudget são os limites compartilhados por todas as caches do programa
+type memoBudget struct {
+	maxEntries int
+	maxBytes   int64
+	entries    int
+	bytes      int64
+
+	// devolvido por caches de closures coletadas pelo GC. O finalizer roda
+	// em outra goroutine, então o total só é descontado quando falta espaço.
+	freedEntries, freedBytes atomic.Int64
+}
+
+func (self *memoBudget) fits(size int64) bool {
+	if self.within(size) {
+		return true
+	}
+	self.entries -= int(self.freedEntries.Swap(0))
+	self.bytes -= self.freedBytes.Swap(0)
+	return self.within(size)
+}
+
+func (self *memoBudget) within(size int64) bool {
+	return (self.maxEntries == 0 || self.entries < self.maxEntries) &&
+		(self.maxBytes == 0 || self.bytes+size <= self.maxBytes)
+}
+
+// ------------------- chaves
+
+// appendMemoKey codifica os argumentos de uma chamada de forma canônica:
+// cada valor leva uma marca do tipo e strings levam o tamanho, então
+// valores diferentes nunca geram a mesma chave. Tuplas são codificadas
+// pelo conteúdo. Closures só entram na chave se não têm efeitos nem
+// capturas locais, e pela identidade da instância, já que == distingue
+// duas closures da mesma função. Retorna false quando a chamada não pode
+// usar a cache.
+func appendMemoKey(key []byte, args []Value) ([]byte, bool) {
+	var buf [16]Value
+	stack := buf[:0]
+	for i := len(args) - 1; i >= 0; i-- {
+		stack = append(stack, args[i])
+	}
+	for len(stack) > 0 {
+		if len(key) > memoKeyLimit {
+			return key, false
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch v.kind {
+		case KindInt:
+			key = strconv.AppendInt(append(key, 'i'), v.num, 10)
+		case KindBigInt:
+			key = appendBigHex(append(key, 'I'), v.Big())
+		case KindFloat:
+			key = strconv.AppendUint(append(key, 'f'), uint64(v.num), 16)
+		case KindBool:
+			key = append(key, 'b', byte('0'+v.num))
+		case KindStr:
+			key = strconv.AppendInt(append(key, 's'), v.num, 10)
+			key = append(append(key, ':'), v.Str()...)
+		case KindClosure:
+			c := v.Closure()
+			if !c.builder.keyable {
+				return key, false
+			}
+			key = strconv.AppendUint(append(key, 'c'), c.id, 10)
+		case KindTuple:
+			t := v.Tuple()
+			key = append(key, 't')
+			stack = append(stack, t[1], t[0])
+			continue
+		default:
+			return key, false
+		}
+		key = append(key, ';')
+	}
+	return key, len(key) <= memoKeyLimit
+}
+
+// memoIntKey é a chave do caso comum, chamadas com poucos argumentos
+// int64 (fib, combination, hanoi): vai direto para o map, sem codificação
+// e sem alocar nem numa falha
+type memoIntKey struct {
+	n    int
+	args [memoIntArity]int64
+}
+
+// custo estimado de uma memoIntKey na entrada
+const memoIntKeySize = int64(unsafe.Sizeof(memoIntKey{}))
+
+func intMemoKey(args []Value) (key memoIntKey, ok bool) {
+	if len(args) > memoIntArity {
+		return key, false
+	}
+	for i, a := range args {
+		if a.kind != KindInt {
+			return key, false
+		}
+		key.args[i] = a.num
+	}
+	key.n = len(args)
+	return key, true
+}
+
+// appendBigHex escreve b em hexadecimal, como b.Text(16), mas sem alocar
+func appendBigHex(key []byte, b *big.Int) []byte {
+	const digits = "0123456789abcdef"
+	if b.Sign() < 0 {
+		key = append(key, '-')
+	}
+	words := b.Bits()
+	key = strconv.AppendUint(key, uint64(words[len(words)-1]), 16)
+	for i := len(words) - 2; i >= 0; i-- {
+		for shift := bits.UintSize - 4; shift >= 0; shift -= 4 {
+			key = append(key, digits[(words[i]>>shift)&15])
+		}
+	}
+	return key
+}
+
+// ------------------- cache
+
+type memoEntry struct {
+	key        string
+	ints       memoIntKey
+	isInts     bool
+	value      Value
+	size       int64
+	freq, tick uint64
+	index      int        // posição no heap (LFU)
+	prev, next *memoEntry // lista do mais recente ao mais antigo (LRU)
+}
+
+// memoStats são as estatísticas de uma função, somando as caches de todas
+// as suas closures
+type memoStats struct {
+	name, location                                      string
+	calls, hits, lookupMisses, skipped, evictions, peak int
+	reason                                              string // por que a cache está desligada
+	loaded                                              int    // resultados lidos do store
+}
+
 type Memoize struct {
-	enabled              bool
-	cache                map[string]interface{}
-	cacheSize, cacheMiss int
+	enabled   bool
+	policy    MemoPolicy
+	limit     int
+	entries   map[string]*memoEntry
+	ints      map[memoIntKey]*memoEntry
+	recent    memoEntry // sentinela da lista LRU
+	lfu       lfuHeap
+	tick      uint64
+	misses    int // consultas sem acerto desde o último acerto
+	missLimit int
+	bytes     int64 // memória estimada das entradas
+	budget    *memoBudget
+	*memoStats
+
+	// store em disco, se houver
+	store       *memoStore
+	fingerprint string
+	stored      map[string]string
+}
+
+func newMemoize(opts MemoOptions, budget *memoBudget) *Memoize {
+	self := &Memoize{
+		enabled:   opts.Policy != MemoOff,
+		policy:    opts.Policy,
+		limit:     opts.MaxEntries,
+		missLimit: opts.MissLimit,
+		budget:    budget,
+		memoStats: &memoStats{},
+	}
+	if self.limit <= 0 {
+		self.limit = MemoizeCacheLimit
+	}
+	if self.policy == MemoUnbounded {
+		self.limit = 0
+	}
+	self.init()
+	return self
+}
+
+func (self *Memoize) init() {
+	self.entries = map[string]*memoEntry{}
+	self.recent.prev, self.recent.next = &self.recent, &self.recent
+}
+
+// instance cria uma cache vazia com a mesma configuração, para uma closure
+// cujo resultado depende das variáveis capturadas
+func (self *Memoize) instance() *Memoize {
+	m := &Memoize{enabled: true, policy: self.policy, limit: self.limit, missLimit: self.missLimit, budget: self.budget, memoStats: self.memoStats}
+	m.init()
+	return m
+}
+
+// memoHandle é a ligação entre uma closure e sua cache. O finalizer fica
+// nele, e não na closure, porque uma closure recursiva referencia a si
+// mesma e um objeto com finalizer num ciclo nunca é coletado. Pelo mesmo
+// motivo, uma cache que guarda a própria closure num resultado só é
+// liberada no fim da execução.
+type memoHandle struct {
+	cache *Memoize
+}
+
+func (self *memoHandle) release() {
+	self.cache.budget.freedEntries.Add(int64(self.cache.len()))
+	self.cache.budget.freedBytes.Add(self.cache.bytes)
+}
+
+// cache retorna a cache da closure, criada na primeira chamada e liberada,
+// junto com o espaço no orçamento global, quando a closure é coletada
+func (self *Closure) cache(template *Memoize) *Memoize {
+	if self.memo == nil {
+		self.memo = &memoHandle{template.instance()}
+		runtime.SetFinalizer(self.memo, (*memoHandle).release)
+	}
+	return self.memo.cache
+}
+
+func (self *Memoize) get(key []byte) (Value, bool) {
+	e, ok := self.entries[string(key)]
+	return self.found(e, ok)
+}
+
+func (self *Memoize) getInts(key memoIntKey) (Value, bool) {
+	e, ok := self.ints[key]
+	return self.found(e, ok)
+}
+
+func (self *Memoize) found(e *memoEntry, ok bool) (Value, bool) {
+	if !ok {
+		self.lookupMisses++
+		if self.limit > 0 && self.len() >= self.limit {
+			if self.misses++; self.misses == self.missLimit {
+				self.enabled = false
+				self.reason = fmt.Sprintf("auto-disabled: no hits in %d lookups with a full cache", self.missLimit)
+			}
+		}
+		return Value{}, false
+	}
+	self.hits++
+	self.misses = 0
+	switch self.policy {
+	case MemoLRU:
+		self.unlink(e)
+		self.pushFront(e)
+	case MemoLFU:
+		self.tick++
+		e.freq++
+		e.tick = self.tick
+		heap.Fix(&self.lfu, e.index)
+	}
+	return e.value, true
+}
+
+// hasClosure indica se v é ou contém, dentro de tuplas, uma closure. Um
+// resultado assim não vai para a cache: cada chamada cria uma instância
+// nova, o que é visível na comparação por identidade.
+func hasClosure(v Value) bool {
+	if v.kind != KindTuple {
+		return v.kind == KindClosure
+	}
+	var buf [16]Value
+	stack := append(buf[:0], v)
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch v.kind {
+		case KindClosure:
+			return true
+		case KindTuple:
+			t := v.Tuple()
+			stack = append(stack, t[0], t[1])
+		}
+	}
+	return false
+}
+
+func (self *Memoize) put(key string, v Value) {
+	if _, ok := self.entries[key]; ok {
+		return
+	}
+	if e := self.alloc(int64(len(key)) + valueSize(v)); e != nil {
+		e.key = key
+		self.entries[key] = e
+		self.insert(e, v)
+	}
+}
+
+func (self *Memoize) putInts(key memoIntKey, v Value) {
+	if _, ok := self.ints[key]; ok {
+		return
+	}
+	if e := self.alloc(memoIntKeySize + valueSize(v)); e != nil {
+		if self.ints == nil {
+			self.ints = map[memoIntKey]*memoEntry{}
+		}
+		e.ints, e.isInts = key, true
+		self.ints[key] = e
+		self.insert(e, v)
+	}
+}
+
+func (self *Memoize) len() int {
+	return len(self.entries) + len(self.ints)
+}
+
+// alloc abre espaço para uma entrada nova, descartando outras se preciso;
+// nil se nem esvaziando esta cache a entrada cabe
+func (self *Memoize) alloc(size int64) *memoEntry {
+	size += memoEntryOverhead
+	var e *memoEntry
+	if self.limit > 0 && self.len() >= self.limit {
+		// sem descarte, como em MemoUnbounded com @memo(limit=N), a
+		// cache cheia não aceita entradas novas
+		if e = self.evict(); e == nil {
+			return nil
+		}
+	}
+	for !self.budget.fits(size) {
+		if e = self.evict(); e == nil {
+			return nil
+		}
+	}
+
+	// reaproveita a entrada descartada
+	if e == nil {
+		e = &memoEntry{}
+	}
+	*e = memoEntry{size: size}
+	return e
+}
+
+func (self *Memoize) insert(e *memoEntry, v Value) {
+	e.value = v
+	self.peak = max(self.peak, self.len())
+	self.bytes += e.size
+	self.budget.entries++
+	self.budget.bytes += e.size
+	switch self.policy {
+	case MemoLRU:
+		self.pushFront(e)
+	case MemoLFU:
+		self.tick++
+		e.freq, e.tick = 1, self.tick
+		heap.Push(&self.lfu, e)
+	}
+}
+
+// evict remove uma entrada segundo a política; nil se não há o que remover
+func (self *Memoize) evict() *memoEntry {
+	var e *memoEntry
+	switch self.policy {
+	case MemoLRU:
+		if e = self.recent.prev; e == &self.recent {
+			return nil
+		}
+		self.unlink(e)
+	case MemoLFU:
+		if len(self.lfu) == 0 {
+			return nil
+		}
+		e = heap.Pop(&self.lfu).(*memoEntry)
+	default:
+		return nil
+	}
+	if e.isInts {
+		delete(self.ints, e.ints)
+	} else {
+		delete(self.entries, e.key)
+	}
+	self.evictions++
+	self.bytes -= e.size
+	self.budget.entries--
+	self.budget.bytes -= e.size
+	return e
+}
+
+func (self *Memoize) pushFront(e *memoEntry) {
+	e.prev, e.next = &self.recent, self.recent.next
+	e.next.prev = e
+	self.recent.next = e
+}
+
+func (self *Memoize) unlink(e *memoEntry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+// valueSize estima a memória ocupada por um valor, sem descer nas tuplas
+func valueSize(v Value) int64 {
+	switch v.kind {
+	case KindStr:
+		return 16 + v.num
+	case KindBigInt:
+		return 48 + int64(len(v.Big().Bits()))*8
+	case KindTuple:
+		return 24 + 2*24
+	}
+	return 24
+}
+
+// lfuHeap ordena pela frequência de uso e, no empate, pelo uso mais antigo
+type lfuHeap []*memoEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*memoEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// ------------------- estatísticas
+
+func writeMemoStats(w io.Writer, caches []*Memoize) {
+	t := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(t, "function\tlocation\tcalls\thits\tloaded\tmisses\tskipped\tevictions\tpeak\tmemo\t")
+	for _, m := range caches {
+		memo := "on"
+		if m.reason != "" {
+			memo = "off: " + m.reason
+		}
+		fmt.Fprintf(t, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			m.name, m.location, m.calls, m.hits, m.loaded, m.lookupMisses, m.skipped, m.evictions, m.peak, memo)
+	}
+	t.Flush()
 }
@@ -0,0 +1,392 @@
+package interpreter
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func memoKeys(m *Memoize) string {
+	keys := []string{}
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if _, ok := m.entries[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	return strings.Join(keys, "")
+}
+
+func TestMemoPolicies(t *testing.T) {
+	tests := []struct {
+		policy MemoPolicy
+		want   string
+	}{
+		// a, b e c entram, a é consultada três vezes, depois b e c uma vez
+		{MemoLRU, "bcd"}, // a é a usada há mais tempo
+		{MemoLFU, "acd"}, // b e c têm menos usos; no empate sai a mais antiga
+		{MemoUnbounded, "abcd"},
+	}
+	for _, tt := range tests {
+		m := newMemoize(MemoOptions{Policy: tt.policy, MaxEntries: 3}, &memoBudget{})
+		m.put("a", Int(1))
+		m.put("b", Int(2))
+		m.put("c", Int(3))
+		m.get([]byte("a"))
+		m.get([]byte("a"))
+		m.get([]byte("a"))
+		m.get([]byte("b"))
+		m.get([]byte("c"))
+		m.put("d", Int(4))
+		if got := memoKeys(m); got != tt.want {
+			t.Errorf("%s: cache has %s, want %s", tt.policy, got, tt.want)
+		}
+		if v, ok := m.get([]byte("d")); !ok || v.num != 4 {
+			t.Errorf("%s: d = %s, %v", tt.policy, v, ok)
+		}
+	}
+
+	if m := newMemoize(MemoOptions{Policy: MemoOff}, &memoBudget{}); m.enabled {
+		t.Errorf("memo policy off left the cache enabled")
+	}
+	for _, name := range []string{"lru", "lfu", "unbounded", "off"} {
+		if p, err := ParseMemoPolicy(name); err != nil || p.String() != name {
+			t.Errorf("ParseMemoPolicy(%q) = %s, %v", name, p, err)
+		}
+	}
+}
+
+func TestMemoBudget(t *testing.T) {
+	budget := &memoBudget{maxEntries: 3}
+	f := newMemoize(MemoOptions{}, budget)
+	g := newMemoize(MemoOptions{}, budget)
+	f.put("a", Int(1))
+	f.put("b", Int(2))
+	g.put("c", Int(3))
+	g.put("d", Int(4)) // g descarta a própria entrada para caber
+	if budget.entries != 3 || memoKeys(f) != "ab" || memoKeys(g) != "d" {
+		t.Errorf("program limit: f=%s g=%s entries=%d", memoKeys(f), memoKeys(g), budget.entries)
+	}
+
+	size := valueSize(Int(0)) + memoEntryOverhead + 1
+	budget = &memoBudget{maxBytes: 2 * size}
+	f = newMemoize(MemoOptions{Policy: MemoLFU}, budget)
+	for _, k := range []string{"a", "b", "c"} {
+		f.put(k, Int(0))
+	}
+	if budget.bytes != 2*size || memoKeys(f) != "bc" {
+		t.Errorf("byte budget: cache has %s using %d bytes", memoKeys(f), budget.bytes)
+	}
+	f.put("e", Str(strings.Repeat("x", 1000))) // maior que o orçamento todo
+	if memoKeys(f) != "" || budget.bytes != 0 {
+		t.Errorf("oversized entry: cache has %s using %d bytes", memoKeys(f), budget.bytes)
+	}
+}
+
+func TestMemoBudgetRuns(t *testing.T) {
+	// cada execução do mesmo programa começa com um orçamento vazio
+	src := "let fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };\nfib(20)"
+	ast, _ := Parse("test.rinha", src)
+	var stats strings.Builder
+	run := BuildAst(src, ast, Options{Memo: MemoOptions{ProgramEntries: 30, Stats: &stats}})
+	for i := 0; i < 2; i++ {
+		stats.Reset()
+		run()
+		lines := strings.Split(strings.TrimRight(stats.String(), "\n"), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("run %d: expected a header and 1 function:\n%s", i+1, stats.String())
+		}
+		if row := strings.Fields(lines[1]); row[7] != "0" || row[8] != "21" {
+			t.Errorf("run %d: %s evictions, peak %s", i+1, row[7], row[8])
+		}
+	}
+}
+
+func TestMemoMissLimit(t *testing.T) {
+	src := "let f = fn (n) => n + 1;\nlet loop = fn (i) => if (i == 0) { 0 } else { f(i) + loop(i - 1) };\nloop(50)"
+	ast, _ := Parse("test.rinha", src)
+	for _, tt := range []struct {
+		limit int
+		want  string
+	}{{0, "on"}, {10, "off: auto-disabled: no hits in 10 lookups with a full cache"}, {100, "on"}} {
+		var stats strings.Builder
+		BuildAst(src, ast, Options{Memo: MemoOptions{MaxEntries: 2, MissLimit: tt.limit, Stats: &stats}})()
+		if row := strings.Split(stats.String(), "\n")[1]; !strings.HasSuffix(strings.TrimSpace(row), tt.want) {
+			t.Errorf("miss limit %d: %q, want %q", tt.limit, row, tt.want)
+		}
+	}
+}
+
+func TestMemoOptions(t *testing.T) {
+	for _, memo := range []MemoOptions{{}, {Policy: MemoLFU, MaxEntries: 2}, {Policy: MemoUnbounded}, {Policy: MemoOff}, {MaxBytes: 1000}} {
+		ast, _ := Parse("test.rinha", `let fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) }; fib(30)`)
+		if got := BuildAst("", ast, Options{Memo: memo})(); got.num != 832040 {
+			t.Errorf("%+v: fib(30) = %s", memo, got)
+		}
+	}
+}
+
+func TestMemoKeys(t *testing.T) {
+	fn := &ScopeBuilder{keyable: true}
+	pure := &Closure{builder: fn, id: 1}
+	other := &Closure{builder: fn, id: 2}
+	values := [][]Value{
+		{Int(1)}, {Int(1), Int(2)}, {Int(12)}, {Str("1")}, {Str("1;")}, {Str("")}, {Str("i1;")},
+		{Float(1)}, {Float(0)}, {Float(math.Copysign(0, -1))}, {Bool(true)}, {Bool(false)},
+		{bigValue("9223372036854775808")}, {bigValue("-9223372036854775809")},
+		{NewTuple(Int(1), Int(2))}, {NewTuple(NewTuple(Int(1), Int(2)), Int(3))}, {NewTuple(Int(1), NewTuple(Int(2), Int(3)))},
+		{Int(1), NewTuple(Int(2), Int(3))}, {NewTuple(Int(1), Int(2)), Int(3)},
+		{closureValue(pure)}, {closureValue(other)}, {NewTuple(closureValue(pure), Str("a"))},
+	}
+	seen := map[string]int{}
+	for i, args := range values {
+		key, ok := appendMemoKey(nil, args)
+		if !ok {
+			t.Errorf("%v is not cacheable", args)
+		}
+		if j, dup := seen[string(key)]; dup {
+			t.Errorf("%v and %v have the same key %q", values[j], args, key)
+		}
+		seen[string(key)] = i
+		if again, _ := appendMemoKey(nil, []Value{args[0]}); len(args) == 1 && string(again) != string(key) {
+			t.Errorf("%v: key is not stable", args)
+		}
+	}
+
+	impure := &Closure{builder: &ScopeBuilder{}, id: 3}
+	if _, ok := appendMemoKey(nil, []Value{NewTuple(Int(1), closureValue(impure))}); ok {
+		t.Errorf("impure closure used as a memo key")
+	}
+	if _, ok := appendMemoKey(nil, []Value{Str(strings.Repeat("x", memoKeyLimit+1))}); ok {
+		t.Errorf("oversized memo key accepted")
+	}
+}
+
+func TestMemoValueKinds(t *testing.T) {
+	// sem memoização cada chamada custaria 2^60 chamadas
+	tests := []string{
+		`let f = fn (s, n) => if (n == 0) { 1 } else { f(s, n - 1) + f(s, n - 1) }; f("x", 60)`,
+		`let f = fn (b, n) => if (n == 0) { 1 } else { f(b, n - 1) + f(b, n - 1) }; f(true, 60)`,
+		`let f = fn (t) => if (first(t) == 0) { 1 } else { f((first(t) - 1, second(t))) + f((first(t) - 1, second(t))) }; f((60, (1, "a")))`,
+		`let g = fn (x) => x; let f = fn (h, n) => if (n == 0) { h(1) } else { f(h, n - 1) + f(h, n - 1) }; f(g, 60)`,
+	}
+	for _, src := range tests {
+		if got := run(t, src); got.String() != "1152921504606846976" {
+			t.Errorf("%s = %s", src, got)
+		}
+	}
+
+	// uma closure com efeito não pode ser chave: cada chamada imprime
+	ast, _ := Parse("test.rinha", `let f = fn (g) => g(); let p = fn () => print(1); f(p) + f(p)`)
+	var out strings.Builder
+	BuildAst("", ast, Options{Output: &out})()
+	if out.String() != "1\n1\n" {
+		t.Errorf("effectful closure argument was memoized: %q", out.String())
+	}
+
+	// closures entram na chave pela instância, não pela função
+	src := `let mk = fn () => { fn (x) => { x } }; let a = mk(); let b = mk(); let eq = fn (g) => { g == a }; let _ = print(eq(a)); print(eq(b))`
+	ast, _ = Parse("test.rinha", src)
+	for _, memo := range []MemoOptions{{}, {Policy: MemoOff}} {
+		out.Reset()
+		BuildAst(src, ast, Options{Output: &out, Memo: memo})()
+		if out.String() != "true\nfalse\n" {
+			t.Errorf("memo %s: %q", memo.Policy, out.String())
+		}
+	}
+
+	// resultados com closures, mesmo dentro de tuplas, não vão para a cache
+	for _, src := range []string{
+		`let mk = fn (n) => fn (x) => x; mk(1) == mk(1)`,
+		`let mk = fn (n) => { (fn (x) => { x }, n) }; first(mk(1)) == first(mk(1))`,
+		`let mk = fn (n) => (n, (n, fn (x) => x)); second(second(mk(1))) == second(second(mk(1)))`,
+	} {
+		if got := run(t, src); got.String() != "false" {
+			t.Errorf("%s = %s", src, got)
+		}
+	}
+}
+
+func TestMemoStats(t *testing.T) {
+	src := "let fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };\n" +
+		"let log = fn (x) => print(x);\n" +
+		"let _ = log(fib(10));\n" +
+		"let make = fn (k) => { let add = fn (x) => x + k; add(1) };\n" +
+		"make(2)"
+	ast, _ := Parse("test.rinha", src)
+	var stats, out strings.Builder
+	BuildAst(src, ast, Options{Output: &out, Memo: MemoOptions{Stats: &stats}})()
+
+	lines := strings.Split(strings.TrimRight(stats.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected a header and 4 functions:\n%s", stats.String())
+	}
+	want := [][]string{
+		{"function", "location", "calls", "hits", "loaded", "misses", "skipped", "evictions", "peak", "memo"},
+		{"fib", "test.rinha:1:11", "19", "8", "0", "11", "0", "0", "11", "on"},
+		{"log", "test.rinha:2:11", "1", "0", "0", "0", "0", "0", "0", "off: effectful"},
+		{"make", "test.rinha:4:12", "1", "0", "0", "1", "0", "0", "1", "on"},
+		{"add", "test.rinha:4:34", "1", "0", "0", "1", "0", "0", "1", "on"},
+	}
+	for i, line := range lines {
+		got := strings.Fields(line)
+		if strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	stats.Reset()
+	BuildAst(src, ast, Options{Output: &out, Memo: MemoOptions{Policy: MemoOff, Stats: &stats}})()
+	if !strings.Contains(stats.String(), "off: memo policy is off") {
+		t.Errorf("memo off not reported:\n%s", stats.String())
+	}
+}
+
+func TestMemoCaptures(t *testing.T) {
+	// f captura t e g da função externa: cada closure de f tem sua própria
+	// cache, então uma instância nunca acerta resultados calculados com
+	// outras capturas
+	tests := []struct{ src, want string }{
+		{`let count = fn (t, n) => { let f = fn (k) => if (k == 0) { t } else { f(k - 1) + f(k - 1) }; f(n) }; count(1, 60) + count(2, 60)`, "3458764513820540928"},
+		{`let id = fn (x) => x; let apply = fn (g, n) => { let f = fn (k) => if (k == 0) { g(1) } else { f(k - 1) + f(k - 1) }; f(n) }; apply(id, 60)`, "1152921504606846976"},
+		{`let outer = fn (s) => { let f = fn (k) => if (k == 0) { (s, k) } else { f(k - 1) }; f(3) }; (outer("a"), outer("b"))`, "((a, 0), (b, 0))"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMemoClosureCaches(t *testing.T) {
+	// cada closure tem sua cache: a e b não compartilham resultados
+	src := `let mk = fn (t) => { let f = fn (k) => t + k; f }; let a = mk(1); let b = mk(2); (a(1), (b(1), a(1)))`
+	if got := run(t, src); got.String() != "(2, (3, 2))" {
+		t.Errorf("%s = %s", src, got)
+	}
+
+	// a cache de uma closure coletada devolve o espaço ao orçamento global
+	budget := &memoBudget{maxEntries: 10}
+	template := newMemoize(MemoOptions{}, budget)
+	func() {
+		c := &Closure{}
+		for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+			c.cache(template).put(k, Int(1))
+		}
+	}()
+	if budget.fits(0) {
+		t.Fatalf("budget is not full")
+	}
+	for i := 0; i < 100 && !budget.fits(0); i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if budget.entries != 0 || budget.bytes != 0 {
+		t.Errorf("budget after release: %d entries, %d bytes", budget.entries, budget.bytes)
+	}
+}
+
+func TestMemoKeyAllocs(t *testing.T) {
+	m := newMemoize(MemoOptions{}, &memoBudget{})
+	ints := []Value{Int(30), Int(4)}
+	tuple := []Value{NewTuple(Int(1), NewTuple(Str("a"), Int(2))), bigValue("9223372036854775808")}
+	key, _ := intMemoKey(ints)
+	m.putInts(key, Int(1))
+	b, _ := appendMemoKey(nil, tuple)
+	m.put(string(b), Int(2))
+
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		key, ok := intMemoKey(ints)
+		if v, hit := m.getInts(key); !ok || !hit || v.num != 1 {
+			t.Fatal("int key not found")
+		}
+		b, ok := appendMemoKey(buf[:0], tuple)
+		if v, hit := m.get(b); !ok || !hit || v.num != 2 {
+			t.Fatal("byte key not found")
+		}
+		// falha também não aloca
+		key.args[0]++
+		m.getInts(key)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per lookup", allocs)
+	}
+	if _, ok := intMemoKey([]Value{Int(1), Int(2), Int(3), Int(4)}); ok {
+		t.Errorf("int key used beyond memoIntArity")
+	}
+	if _, ok := intMemoKey([]Value{Int(1), bigValue("9223372036854775808")}); ok {
+		t.Errorf("int key used for a bigint")
+	}
+}
+
+func benchmarkMemoLookup(b *testing.B, args []Value) {
+	m := newMemoize(MemoOptions{}, &memoBudget{})
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if key, ok := intMemoKey(args); ok {
+			if _, hit := m.getInts(key); !hit {
+				m.putInts(key, Int(1))
+			}
+			continue
+		}
+		key, _ := appendMemoKey(buf[:0], args)
+		buf = key[:0]
+		if _, hit := m.get(key); !hit {
+			m.put(string(key), Int(1))
+		}
+	}
+}
+
+func BenchmarkMemoLookupInts(b *testing.B) { benchmarkMemoLookup(b, []Value{Int(50), Int(5)}) }
+func BenchmarkMemoLookupTuple(b *testing.B) {
+	benchmarkMemoLookup(b, []Value{NewTuple(Int(50), Str("x"))})
+}
+
+func TestMemoDirectivesBuild(t *testing.T) {
+	src := "// @nomemo\nlet fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };\n" +
+		"// @memo(limit=1000)\nlet count = fn (n) => if (n == 0) { 0 } else { count(n - 1) + 1 };\n" +
+		"// @memo\nlet log = fn (x) => { let _ = print(x); x };\n" +
+		"(fib(10), (count(500), log(1) + log(1)))"
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats, out, warnings strings.Builder
+	v := BuildAst(src, ast, Options{Output: &out, Warnings: &warnings, Memo: MemoOptions{Stats: &stats}})()
+	if v.String() != "(55, (500, 2))" {
+		t.Errorf("result = %s", v)
+	}
+	// log foi memoizada à força: imprime uma vez só
+	if out.String() != "1\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if warnings.String() != "warning: test.rinha:6:11: @memo on effectful function 'log'\n" {
+		t.Errorf("warnings = %q", warnings.String())
+	}
+	lines := strings.Split(stats.String(), "\n")
+	for i, want := range []string{"fib ... 177 0 0 0 0 0 0 off: disabled by @nomemo", "count ... 501 0 0 501 0 0 501 on", "log ... 2 1 0 1 0 0 1 on"} {
+		fields := strings.Fields(lines[i+1])
+		if got := strings.Join(append(fields[:1:1], append([]string{"..."}, fields[2:]...)...), " "); got != want {
+			t.Errorf("stats %q, want %q", got, want)
+		}
+	}
+
+	// @memo(limit=N) também vale com --memo=unbounded: a cache para de
+	// crescer no limite, sem descartar entradas
+	src = "// @memo(limit=10)\nlet count = fn (n) => if (n == 0) { 0 } else { count(n - 1) + 1 };\ncount(500)"
+	ast, err = Parse("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.Reset()
+	if v := BuildAst(src, ast, Options{Memo: MemoOptions{Policy: MemoUnbounded, Stats: &stats}})(); v.String() != "500" {
+		t.Errorf("unbounded result = %s", v)
+	}
+	fields := strings.Fields(strings.Split(stats.String(), "\n")[1])
+	if got, want := strings.Join(append(fields[:1:1], fields[2:]...), " "), "count 501 0 0 501 0 0 10 on"; got != want {
+		t.Errorf("unbounded stats %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,491 @@
+package interpreter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parser nativo da Rinha. Gera a mesma AST (em json) do parser de
+// referência, com as extensões suportadas por este interpretador:
+// literais float, os operadores unários - e ! e as diretivas de
+// memoização em comentários (@memo, @nomemo e @memo(limit=N)) antes de um
+// let de função, que viram o campo "memo" do nó Function.
+
+type tokenKind uint8
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenStr
+	tokenSymbol
+)
+
+type token struct {
+	kind       tokenKind
+	text       string
+	start, end int
+	directive  *memoDirective // diretiva num comentário logo antes do token
+}
+
+type memoDirective struct {
+	enabled bool
+	limit   int64
+	offset  int
+	used    bool
+}
+
+var memoDirectivePattern = regexp.MustCompile(`(^|[^\w@])@(no)?memo\b(\(([^)]*)\))?`)
+
+var symbols = []string{
+	"=>", "==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "{", "}", ",", ";", "=", "+", "-", "*", "/", "%", "<", ">", "!",
+}
+
+var binaryLevels = [][]struct{ symbol, op string }{
+	{{"||", "Or"}},
+	{{"&&", "And"}},
+	{{"==", "Eq"}, {"!=", "Neq"}},
+	{{"<=", "Lte"}, {">=", "Gte"}, {"<", "Lt"}, {">", "Gt"}},
+	{{"+", "Add"}, {"-", "Sub"}},
+	{{"*", "Mul"}, {"/", "Div"}, {"%", "Rem"}},
+}
+
+type ParseError struct {
+	File      string
+	Line, Col int
+	Message   string
+}
+
+func (self *ParseError) Error() string {
+	return fmt.Sprintf("Parse error in file: '%s', line: %d, col: %d\n%s", self.File, self.Line, self.Col, self.Message)
+}
+
+type parser struct {
+	file   string
+	src    string
+	tokens []token
+	pos    int
+}
+
+// Parse converte o código fonte em AST
+func Parse(file, src string) (ast map[string]interface{}, err error) {
+	p := &parser{file: file, src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*ParseError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	p.tokenize()
+	expression := p.term()
+	p.expect(tokenEOF, "")
+	for _, t := range p.tokens {
+		if t.directive != nil && !t.directive.used {
+			p.fail(t.directive.offset, "memo directives must precede a let-bound function")
+		}
+	}
+	return map[string]interface{}{
+		"name":       file,
+		"expression": expression,
+		"location":   expression["location"],
+	}, nil
+}
+
+func (self *parser) fail(offset int, format string, args ...interface{}) {
+	line, col := lineCol(self.src, offset)
+	panic(&ParseError{File: self.file, Line: line, Col: col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (self *parser) tokenize() {
+	src := self.src
+	i := 0
+	var directive *memoDirective
+	for {
+		// espaços e comentários
+		for i < len(src) {
+			if strings.ContainsRune(" \t\r\n", rune(src[i])) {
+				i++
+			} else if strings.HasPrefix(src[i:], "//") {
+				start := i
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+				directive = self.directive(start, i, directive)
+			} else if strings.HasPrefix(src[i:], "/*") {
+				end := strings.Index(src[i+2:], "*/")
+				if end < 0 {
+					self.fail(i, "unterminated comment")
+				}
+				directive = self.directive(i, i+end+2, directive)
+				i += end + 4
+			} else {
+				break
+			}
+		}
+		if i == len(src) {
+			self.tokens = append(self.tokens, token{kind: tokenEOF, start: i, end: i, directive: directive})
+			return
+		}
+
+		start := i
+		c := src[i]
+		switch {
+		case isLetter(c):
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			self.tokens = append(self.tokens, token{tokenIdent, src[start:i], start, i, nil})
+
+		case isDigit(c):
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			kind := tokenInt
+			if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				kind = tokenFloat
+				for i++; i < len(src) && isDigit(src[i]); i++ {
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && isDigit(src[j]) {
+					kind = tokenFloat
+					for i = j; i < len(src) && isDigit(src[i]); i++ {
+					}
+				}
+			}
+			self.tokens = append(self.tokens, token{kind, src[start:i], start, i, nil})
+
+		case c == '"':
+			var text strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					self.fail(start, "unterminated string")
+				}
+				if src[i] == '"' {
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						text.WriteByte('\n')
+					case 't':
+						text.WriteByte('\t')
+					case 'r':
+						text.WriteByte('\r')
+					default:
+						text.WriteByte(src[i])
+					}
+					continue
+				}
+				text.WriteByte(src[i])
+			}
+			i++
+			self.tokens = append(self.tokens, token{tokenStr, text.String(), start, i, nil})
+
+		default:
+			found := false
+			for _, s := range symbols {
+				if strings.HasPrefix(src[i:], s) {
+					i += len(s)
+					self.tokens = append(self.tokens, token{tokenSymbol, s, start, i, nil})
+					found = true
+					break
+				}
+			}
+			if !found {
+				self.fail(i, "unexpected character %q", c)
+			}
+		}
+		self.tokens[len(self.tokens)-1].directive, directive = directive, nil
+	}
+}
+
+// directive procura diretivas de memoização no comentário src[start:end];
+// a última encontrada vale para o próximo token
+func (self *parser) directive(start, end int, current *memoDirective) *memoDirective {
+	for _, m := range memoDirectivePattern.FindAllStringSubmatchIndex(self.src[start:end], -1) {
+		d := &memoDirective{enabled: m[4] < 0, offset: start + m[3]}
+		if m[8] >= 0 {
+			args := self.src[start+m[8] : start+m[9]]
+			if !d.enabled {
+				self.fail(d.offset, "@nomemo takes no arguments")
+			}
+			for _, arg := range strings.Split(args, ",") {
+				name, value, _ := strings.Cut(arg, "=")
+				limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+				if strings.TrimSpace(name) != "limit" || err != nil || limit <= 0 {
+					self.fail(d.offset, "invalid memo directive argument '%s' (expected limit=N)", strings.TrimSpace(arg))
+				}
+				d.limit = limit
+			}
+		}
+		current = d
+	}
+	return current
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// ------------------- gramática
+
+func (self *parser) peek() token {
+	return self.tokens[self.pos]
+}
+
+func (self *parser) next() token {
+	t := self.tokens[self.pos]
+	if t.kind != tokenEOF {
+		self.pos++
+	}
+	return t
+}
+
+func (self *parser) is(kind tokenKind, text string) bool {
+	t := self.peek()
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+func (self *parser) accept(kind tokenKind, text string) bool {
+	if self.is(kind, text) {
+		self.next()
+		return true
+	}
+	return false
+}
+
+func (self *parser) expect(kind tokenKind, text string) token {
+	if !self.is(kind, text) {
+		t := self.peek()
+		expected := text
+		if expected == "" {
+			expected = map[tokenKind]string{tokenEOF: "end of file", tokenIdent: "identifier"}[kind]
+		}
+		found := "'" + t.text + "'"
+		if t.kind == tokenEOF {
+			found = "end of file"
+		}
+		self.fail(t.start, "expected %s, found %s", expected, found)
+	}
+	return self.next()
+}
+
+func (self *parser) location(start, end int) map[string]interface{} {
+	return map[string]interface{}{"start": float64(start), "end": float64(end), "filename": self.file}
+}
+
+func (self *parser) node(kind string, start, end int, fields ...interface{}) map[string]interface{} {
+	n := map[string]interface{}{"kind": kind, "location": self.location(start, end)}
+	for i := 0; i < len(fields); i += 2 {
+		n[fields[i].(string)] = fields[i+1]
+	}
+	return n
+}
+
+func (self *parser) ident() map[string]interface{} {
+	t := self.expect(tokenIdent, "")
+	if isKeyword(t.text) {
+		self.fail(t.start, "expected identifier, found keyword '%s'", t.text)
+	}
+	return map[string]interface{}{"text": t.text, "location": self.location(t.start, t.end)}
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "let", "fn", "if", "else", "true", "false", "print", "first", "second":
+		return true
+	}
+	return false
+}
+
+func termEnd(term map[string]interface{}) int {
+	return int(term["location"].(map[string]interface{})["end"].(float64))
+}
+
+func termStart(term map[string]interface{}) int {
+	return int(term["location"].(map[string]interface{})["start"].(float64))
+}
+
+func (self *parser) term() map[string]interface{} {
+	if self.is(tokenIdent, "let") {
+		let := self.next()
+		name := self.ident()
+		self.expect(tokenSymbol, "=")
+		value := self.term()
+		if d := let.directive; d != nil {
+			if value["kind"] != "Function" {
+				self.fail(d.offset, "memo directives must precede a let-bound function")
+			}
+			memo := map[string]interface{}{"enabled": d.enabled}
+			if d.limit > 0 {
+				memo["limit"] = d.limit
+			}
+			value["memo"] = memo
+			d.used = true
+		}
+		self.expect(tokenSymbol, ";")
+		next := self.term()
+		return self.node("Let", let.start, termEnd(next), "name", name, "value", value, "next", next)
+	}
+	return self.binary(0)
+}
+
+// Como no parser de referência, operadores binários associam à direita:
+// a - b - c é a - (b - c)
+func (self *parser) binary(level int) map[string]interface{} {
+	if level == len(binaryLevels) {
+		return self.unary()
+	}
+	lhs := self.binary(level + 1)
+	for _, o := range binaryLevels[level] {
+		if self.accept(tokenSymbol, o.symbol) {
+			rhs := self.binary(level)
+			return self.node("Binary", termStart(lhs), termEnd(rhs), "lhs", lhs, "op", o.op, "rhs", rhs)
+		}
+	}
+	return lhs
+}
+
+func (self *parser) unary() map[string]interface{} {
+	t := self.peek()
+	op := map[string]string{"-": "Neg", "!": "Not"}[t.text]
+	if t.kind == tokenSymbol && op != "" {
+		self.next()
+		value := self.unary()
+		return self.node("Unary", t.start, termEnd(value), "op", op, "value", value)
+	}
+	return self.call()
+}
+
+func (self *parser) call() map[string]interface{} {
+	callee := self.primary()
+	for self.is(tokenSymbol, "(") {
+		self.next()
+		args := []interface{}{}
+		for !self.is(tokenSymbol, ")") {
+			args = append(args, self.term())
+			if !self.accept(tokenSymbol, ",") {
+				break
+			}
+		}
+		closing := self.expect(tokenSymbol, ")")
+		callee = self.node("Call", termStart(callee), closing.end, "callee", callee, "arguments", args)
+	}
+	return callee
+}
+
+func (self *parser) block() (term map[string]interface{}, closing token) {
+	self.expect(tokenSymbol, "{")
+	term = self.term()
+	return term, self.expect(tokenSymbol, "}")
+}
+
+func (self *parser) primary() map[string]interface{} {
+	t := self.next()
+	switch t.kind {
+	case tokenInt:
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			self.fail(t.start, "integer literal out of range: %s", t.text)
+		}
+		return self.node("Int", t.start, t.end, "value", v)
+
+	case tokenFloat:
+		v, _ := strconv.ParseFloat(t.text, 64)
+		return self.node("Float", t.start, t.end, "value", v)
+
+	case tokenStr:
+		return self.node("Str", t.start, t.end, "value", t.text)
+
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return self.node("Bool", t.start, t.end, "value", t.text == "true")
+
+		case "print", "first", "second":
+			self.expect(tokenSymbol, "(")
+			value := self.term()
+			closing := self.expect(tokenSymbol, ")")
+			kind := map[string]string{"print": "Print", "first": "First", "second": "Second"}[t.text]
+			return self.node(kind, t.start, closing.end, "value", value)
+
+		case "fn":
+			self.expect(tokenSymbol, "(")
+			params := []interface{}{}
+			for !self.is(tokenSymbol, ")") {
+				params = append(params, self.ident())
+				if !self.accept(tokenSymbol, ",") {
+					break
+				}
+			}
+			self.expect(tokenSymbol, ")")
+			self.expect(tokenSymbol, "=>")
+			if self.is(tokenSymbol, "{") {
+				body, closing := self.block()
+				return self.node("Function", t.start, closing.end, "parameters", params, "value", body)
+			}
+			body := self.term()
+			return self.node("Function", t.start, termEnd(body), "parameters", params, "value", body)
+
+		case "if":
+			self.expect(tokenSymbol, "(")
+			condition := self.term()
+			self.expect(tokenSymbol, ")")
+			then, _ := self.block()
+			self.expect(tokenIdent, "else")
+			if self.is(tokenIdent, "if") {
+				otherwise := self.primary()
+				return self.node("If", t.start, termEnd(otherwise), "condition", condition, "then", then, "otherwise", otherwise)
+			}
+			otherwise, closing := self.block()
+			return self.node("If", t.start, closing.end, "condition", condition, "then", then, "otherwise", otherwise)
+
+		case "let", "else":
+			self.fail(t.start, "unexpected keyword '%s'", t.text)
+		}
+		return self.node("Var", t.start, t.end, "text", t.text)
+
+	case tokenSymbol:
+		switch t.text {
+		case "(":
+			first := self.term()
+			if self.accept(tokenSymbol, ",") {
+				second := self.term()
+				closing := self.expect(tokenSymbol, ")")
+				return self.node("Tuple", t.start, closing.end, "first", first, "second", second)
+			}
+			self.expect(tokenSymbol, ")")
+			return first
+		case "{":
+			self.pos--
+			term, _ := self.block()
+			return term
+		}
+	}
+
+	found := "'" + t.text + "'"
+	if t.kind == tokenEOF {
+		found = "end of file"
+	} else if t.kind == tokenStr {
+		found = "string"
+	}
+	self.fail(t.start, "unexpected %s", found)
+	return nil
+}
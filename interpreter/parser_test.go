@@ -0,0 +1,215 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// normalize deixa a AST no formato do json: números como float64
+func normalize(v interface{}) interface{} {
+	b, _ := json.Marshal(v)
+	var out interface{}
+	json.Unmarshal(b, &out)
+	return out
+}
+
+// withoutLocations remove as localizações de uma AST normalizada
+func withoutLocations(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		delete(x, "location")
+		for _, c := range x {
+			withoutLocations(c)
+		}
+	case []interface{}:
+		for _, c := range x {
+			withoutLocations(c)
+		}
+	}
+	return v
+}
+
+// Os json de exemplo foram gerados pelo parser de referência a partir de
+// fontes com quebras de linha \r\n, daí a conversão para comparar as
+// localizações. Os fontes de fib e operators foram editados depois de
+// gerar o json e só a estrutura é comparada.
+func TestParseExamples(t *testing.T) {
+	edited := map[string]bool{"fib.rinha": true, "operators.rinha": true}
+	files, _ := os.ReadDir("../examples")
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".rinha") {
+			continue
+		}
+		name := "../examples/" + file.Name()
+		src, _ := os.ReadFile(name)
+		want, _ := os.ReadFile(strings.TrimSuffix(name, "rinha") + "json")
+		ast, err := Parse(name, strings.ReplaceAll(string(src), "\n", "\r\n"))
+		if err != nil {
+			t.Errorf("%s: %v", file.Name(), err)
+			continue
+		}
+		got, expected := normalize(ast), normalize(ParseAst(want))
+		if edited[file.Name()] {
+			got, expected = withoutLocations(got), withoutLocations(expected)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			g, _ := json.Marshal(got)
+			t.Errorf("%s: AST differs from the reference parser:\n%s\n%s", file.Name(), g, want)
+		}
+	}
+}
+
+func run(t *testing.T, src string) Value {
+	t.Helper()
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return BuildAst(src, ast, Options{})()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`1 + 2 * 3`, "7"},
+		{`(1 + 2) * 3`, "9"},
+		{`10 - 2 - 3`, "11"}, // associa à direita, como o parser de referência
+		{`1 < 2 && 2 < 3 || false`, "true"},
+		{`let f = fn (a, b) => a + b; f(1, 2)`, "3"},
+		{`let t = (1, "a"); second(t) + first(t)`, "a1"},
+		{`if (1 == 1) { "a" } else if (true) { "b" } else { "c" }`, "a"},
+		{"/* comentário */ let x = 1; // outro\n x", "1"},
+		{`"a\"b"`, `a"b`},
+		{`1.5e1 + 0.5`, "15.5"},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+		message   string
+	}{
+		{"let x = ;\nx", 1, 9, "unexpected ';'"},
+		{"let x = 1;\nlet = 2; x", 2, 5, "expected identifier, found '='"},
+		{"print(1", 1, 8, "expected ), found end of file"},
+		{"fn (if) => 1", 1, 5, "expected identifier, found keyword 'if'"},
+		{"1 # 2", 1, 3, "unexpected character '#'"},
+		{"99999999999999999999", 1, 1, "integer literal out of range: 99999999999999999999"},
+		{"// @memo\n1", 1, 4, "memo directives must precede a let-bound function"},
+		{"/* @nomemo */ let x = 1; x", 1, 4, "memo directives must precede a let-bound function"},
+		{"let f /* @memo */ = fn () => 1; f()", 1, 10, "memo directives must precede a let-bound function"},
+		{"// @memo(size=3)\nlet f = fn () => 1; f()", 1, 4, "invalid memo directive argument 'size=3' (expected limit=N)"},
+		{"// @memo(limit=0)\nlet f = fn () => 1; f()", 1, 4, "invalid memo directive argument 'limit=0' (expected limit=N)"},
+		{"// @nomemo(limit=2)\nlet f = fn () => 1; f()", 1, 4, "@nomemo takes no arguments"},
+	}
+	for _, tt := range tests {
+		_, err := Parse("test.rinha", tt.src)
+		e, ok := err.(*ParseError)
+		if !ok || e.Line != tt.line || e.Col != tt.col || e.Message != tt.message {
+			t.Errorf("%q: got %v, want %d:%d %s", tt.src, err, tt.line, tt.col, tt.message)
+		}
+	}
+}
+
+func TestUnary(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		kind Kind
+	}{
+		{`-5`, "-5", KindInt},
+		{`- -5`, "5", KindInt},
+		{`-2 * 3`, "-6", KindInt},
+		{`1 - -1`, "2", KindInt},
+		{`-1.5`, "-1.5", KindFloat},
+		{`let x = 2.5; -x`, "-2.5", KindFloat},
+		{`!true`, "false", KindBool},
+		{`!(1 < 2) || true`, "true", KindBool},
+		{`let f = fn (b) => !b; f(false)`, "true", KindBool},
+		{`let m = -9223372036854775807 - 1; -m`, "9223372036854775808", KindBigInt},
+		{`let m = -9223372036854775807 - 1; -(-m)`, "-9223372036854775808", KindInt},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.src); got.String() != tt.want || got.kind != tt.kind {
+			t.Errorf("%s = %s (kind %d), want %s (kind %d)", tt.src, got, got.kind, tt.want, tt.kind)
+		}
+	}
+
+	ast, _ := Parse("test.rinha", "-5")
+	if lit := field(Fold(ast, IntModeBigInt), "expression"); lit["kind"] != "Int" || lit["value"] != int64(-5) {
+		t.Errorf("-5 not folded: %v", lit)
+	}
+	ast, _ = Parse("test.rinha", "!false")
+	if lit := field(Fold(ast, IntModeBigInt), "expression"); lit["kind"] != "Bool" || lit["value"] != true {
+		t.Errorf("!false not folded: %v", lit)
+	}
+
+	wrap := IntModeI64Wrap
+	ast, _ = Parse("test.rinha", "let m = -9223372036854775807 - 1; -m")
+	if got := BuildAst("", ast, Options{IntMode: wrap})(); got.String() != "-9223372036854775808" {
+		t.Errorf("%s: -MinInt64 = %s, want MinInt64", wrap, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+	}{
+		{`{"kind": "Pow", "location": {"start": 3, "end": 4}}`, `unknown node kind "Pow"`},
+		{`{"kind": "Binary", "op": "Pow", "lhs": {"kind": "Int", "value": 1}, "rhs": {"kind": "Int", "value": 2}}`, `unknown binary operator "Pow"`},
+		{`{"kind": "Unary", "op": "Inv", "value": {"kind": "Int", "value": 1}}`, `unknown unary operator "Inv"`},
+		{`{"kind": "Binary", "op": "Add", "lhs": {"kind": "Int", "value": 1}}`, "Binary node without 'rhs'"},
+		{`{"kind": "Print", "value": {"kind": "Str", "value": 1}}`, "Str node with invalid 'value'"},
+		{`{"kind": "Function", "parameters": [{"name": "x"}], "value": {"kind": "Int", "value": 1}}`, "Function node with invalid 'parameters'"},
+		{`{"kind": "Call", "callee": {"kind": "Var", "text": "f"}, "arguments": [{"kind": "Var"}]}`, "Var node without 'text'"},
+		{`{"kind": "Function", "parameters": [], "value": {"kind": "Int", "value": 1}, "memo": {"limit": 10}}`, "Function node with invalid 'memo'"},
+		{`{"kind": "Function", "parameters": [], "value": {"kind": "Int", "value": 1}, "memo": {"enabled": true, "limit": -1}}`, "Function node with invalid 'memo'"},
+	}
+	for _, tt := range tests {
+		err := Validate(ParseAst([]byte(`{"name": "test", "expression": ` + tt.expression + `}`)))
+		if e, ok := err.(*ValidationError); !ok || e.Message != tt.message {
+			t.Errorf("%s: got %v, want %s", tt.expression, err, tt.message)
+		}
+	}
+	if err := Validate(map[string]interface{}{}); err == nil {
+		t.Errorf("AST without expression accepted")
+	}
+	if err := Validate(ParseAst([]byte(`{"expression": {"kind": "Pow", "location": {"start": 3, "end": 4}}}`))); err.(*ValidationError).Location["start"] != float64(3) {
+		t.Errorf("validation error without location: %v", err)
+	}
+}
+
+func TestMemoDirectives(t *testing.T) {
+	src := "// cache maior: @memo(limit=10000)\nlet f = fn (n) => n;\n/* @nomemo */ let g = fn (n) => n;\n// @memo @nomemo\nlet h = fn (n) => n;\nlet i = fn (n) => n;\n// email@memo.com não é diretiva\n0"
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"f": map[string]interface{}{"enabled": true, "limit": int64(10000)},
+		"g": map[string]interface{}{"enabled": false},
+		"h": map[string]interface{}{"enabled": false}, // vale a última
+		"i": nil,
+	}
+	for let := ast["expression"].(map[string]interface{}); let["kind"] == "Let"; let = let["next"].(map[string]interface{}) {
+		name := let["name"].(map[string]interface{})["text"].(string)
+		if got := let["value"].(map[string]interface{})["memo"]; !reflect.DeepEqual(got, want[name]) {
+			t.Errorf("%s: memo = %v, want %v", name, got, want[name])
+		}
+	}
+	if err := Validate(ast); err != nil {
+		t.Errorf("directives rejected by Validate: %v", err)
+	}
+}
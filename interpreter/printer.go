@@ -0,0 +1,139 @@
+package interpreter
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PrintOptions controla a formatação de valores. O valor zero mostra tudo
+// numa única linha.
+type PrintOptions struct {
+	MaxDepth     int  // tuplas abaixo dessa profundidade viram (...); 0 é sem limite
+	MaxElements  int  // valores mostrados antes de cortar com ...; 0 é sem limite
+	BigIntDigits int  // bigints maiores são abreviados; 0 mostra todos os dígitos
+	Pretty       bool // uma linha por elemento de tupla, com indentação
+}
+
+// errorFormat é usado quando um valor aparece numa mensagem de erro
+var errorFormat = PrintOptions{MaxDepth: 4, MaxElements: 16, BigIntDigits: 32}
+
+type printItem struct {
+	value Value
+	depth int
+	text  string // texto fixo, quando não é um valor
+	sep   string // separador emitido antes do valor
+}
+
+// Format formata v sem recursão, então tuplas aninhadas em qualquer
+// profundidade (listas encadeadas, por exemplo) não estouram a pilha
+func (o PrintOptions) Format(v Value) string {
+	var b strings.Builder
+	o.Write(&b, v)
+	return b.String()
+}
+
+func (o PrintOptions) Write(w io.Writer, v Value) error {
+	return o.write(w, v, "")
+}
+
+// WriteLine é Write seguido de uma quebra de linha, como no print
+func (o PrintOptions) WriteLine(w io.Writer, v Value) error {
+	return o.write(w, v, "\n")
+}
+
+func (o PrintOptions) write(w io.Writer, v Value, suffix string) error {
+	if v.kind != KindTuple && (v.kind != KindBigInt || o.BigIntDigits <= 0) {
+		_, err := io.WriteString(w, v.scalarString()+suffix)
+		return err
+	}
+	var b strings.Builder
+	stack := []printItem{{value: v}}
+	elements := 0
+	truncated := false
+
+	newline := func(depth int) {
+		b.WriteByte('\n')
+		for i := 0; i < depth; i++ {
+			b.WriteString("  ")
+		}
+	}
+
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if item.value.kind == KindNone {
+			if item.text == ")" && o.Pretty {
+				newline(item.depth)
+			}
+			b.WriteString(item.text)
+			continue
+		}
+		if truncated {
+			continue
+		}
+		b.WriteString(item.sep)
+		if o.Pretty && item.depth > 0 {
+			newline(item.depth)
+		}
+		if o.MaxElements > 0 && elements == o.MaxElements {
+			b.WriteString("...")
+			truncated = true
+			continue
+		}
+
+		switch v := item.value; v.kind {
+		case KindTuple:
+			if o.MaxDepth > 0 && item.depth >= o.MaxDepth {
+				b.WriteString("(...)")
+				elements++
+				continue
+			}
+			t := v.Tuple()
+			b.WriteByte('(')
+			// empilhados em ordem inversa
+			stack = append(stack,
+				printItem{text: ")", depth: item.depth},
+				printItem{value: t[1], depth: item.depth + 1, sep: o.separator()},
+				printItem{value: t[0], depth: item.depth + 1},
+			)
+		case KindBigInt:
+			b.WriteString(o.bigInt(v))
+			elements++
+		default:
+			b.WriteString(v.scalarString())
+			elements++
+		}
+
+		// descarrega aos poucos saídas grandes
+		if b.Len() >= 1<<16 {
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	b.WriteString(suffix)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (o PrintOptions) separator() string {
+	if o.Pretty {
+		return ","
+	}
+	return ", "
+}
+
+// bigInt abrevia números muito longos: 12345...67890 (120 digits)
+func (o PrintOptions) bigInt(v Value) string {
+	s := v.Big().String()
+	digits := len(strings.TrimPrefix(s, "-"))
+	if o.BigIntDigits <= 0 || digits <= o.BigIntDigits {
+		return s
+	}
+	half := (o.BigIntDigits + 1) / 2
+	sign := len(s) - digits
+	return s[:sign+half] + "..." + s[len(s)-o.BigIntDigits/2:] + " (" + strconv.Itoa(digits) + " digits)"
+}
@@ -0,0 +1,45 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrinter(t *testing.T) {
+	nested := NewTuple(Int(1), NewTuple(Str("a"), NewTuple(Bool(true), Float(2))))
+	huge := bigValue("-123456789012345678901234567890")
+	tests := []struct {
+		opts  PrintOptions
+		value Value
+		want  string
+	}{
+		{PrintOptions{}, nested, "(1, (a, (true, 2.0)))"},
+		{PrintOptions{MaxDepth: 2}, nested, "(1, (a, (...)))"},
+		{PrintOptions{MaxDepth: 1}, NewTuple(nested, Int(2)), "((...), 2)"},
+		{PrintOptions{MaxElements: 2}, nested, "(1, (a, ...))"},
+		{PrintOptions{MaxElements: 1}, NewTuple(NewTuple(Int(1), Int(2)), Int(3)), "((1, ...))"},
+		{PrintOptions{}, huge, "-123456789012345678901234567890"},
+		{PrintOptions{BigIntDigits: 10}, huge, "-12345...67890 (30 digits)"},
+		{PrintOptions{BigIntDigits: 10}, NewTuple(huge, Int(1)), "(-12345...67890 (30 digits), 1)"},
+		{PrintOptions{Pretty: true}, Int(1), "1"},
+		{PrintOptions{Pretty: true}, NewTuple(Int(1), NewTuple(Int(2), Int(3))), "(\n  1,\n  (\n    2,\n    3\n  )\n)"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Format(tt.value); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+
+	// sem limite de recursão
+	list := Int(0)
+	for i := 0; i < 1000000; i++ {
+		list = NewTuple(Int(1), list)
+	}
+	s := list.String()
+	if !strings.HasPrefix(s, "(1, (1, ") || !strings.HasSuffix(s, "0"+strings.Repeat(")", 1000000)) {
+		t.Errorf("deep tuple printed wrong: %s...", s[:20])
+	}
+	if got := (PrintOptions{MaxElements: 3}).Format(list); got != "(1, (1, (1, ..."+")))" {
+		t.Errorf("truncated deep tuple: %q", got)
+	}
+}
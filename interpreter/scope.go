@@ -1,64 +1,265 @@
 package interpreter
 
+import "unsafe"
+
+const (
+	FramePoolLimit = 4096
+)
+
+// ScopeInstance é o frame de uma chamada: slots locais e a closure em execução
 type ScopeInstance struct {
-	parent  *ScopeInstance
-	builder *ScopeBuilder
-	data    []interface{}
+	closure *Closure
+	data    []Value
 }
 
-func (self *ScopeInstance) Set(index int, v interface{}) {
+func (self *ScopeInstance) Set(index int, v Value) {
 	self.data[index] = v
 }
 
-func (self *ScopeInstance) Find(name string) interface{} {
-	if i, h := self.builder.indexes[name]; h {
-		if self.data[i] != nil {
-			return self.data[i]
-		}
+// cell retorna a cell do slot index, criando-a se o let ainda não rodou.
+// Se o slot já tem um valor, a cell só guarda uma cópia dele.
+func (self *ScopeInstance) cell(index int) Value {
+	v := self.data[index]
+	if v.kind == KindNone && v.ref != nil {
+		return v
 	}
-	if self.parent != nil {
-		return self.parent.Find(name)
+	c := cellValue(&cell{value: v})
+	if v.kind == KindNone {
+		self.data[index] = c
 	}
-	return nil
+	return c
 }
 
-func (self *ScopeInstance) Value(index int, scope *ScopeBuilder) interface{} {
-	if scope == self.builder {
-		return self.data[index]
-	}
-	return nil
+// Closure guarda apenas as variáveis livres da função, copiadas na criação
+type Closure struct {
+	builder  *ScopeBuilder
+	captured []Value
+	memo     *memoHandle // cache própria, se a função usa uma por closure
+	id       uint64      // identidade estável, usada nas chaves de memoização
+}
+
+// cell guarda um let que foi capturado antes de ser atribuído; a closure
+// copia a cell e lê o valor quando o let termina
+type cell struct {
+	value Value
 }
 
-func (self *ScopeInstance) Child(scope *ScopeBuilder) *ScopeInstance {
-	return &ScopeInstance{parent: self, builder: scope, data: make([]interface{}, scope.seq)}
+func cellValue(c *cell) Value {
+	return Value{ref: unsafe.Pointer(c)}
+}
+
+func (v Value) cell() *cell {
+	return (*cell)(v.ref)
 }
 
 // -------------------
 
+// capture indica de onde copiar uma variável livre no escopo que cria a closure
+type capture struct {
+	local bool
+	index int
+	cell  bool // a variável é lida através de uma cell
+}
+
+// forwardLet é o slot reservado para um let ainda não construído de um
+// bloco de lets
+type forwardLet struct {
+	slot  int
+	chain int // bloco que declara o let
+}
+
 type ScopeBuilder struct {
-	indexes map[string]int
-	seq     int
+	parent *ScopeBuilder
+	names  map[string]int
+	seq    int
 
 	// closure
-	body         func() interface{}
-	paramIndexes []int
-	memoize      *Memoize
+	body           NodeExecutor
+	paramIndexes   []int
+	memoize        *Memoize
+	keyable        bool // sem efeitos e sem capturas locais: pode ser argumento de uma chamada memoizada
+	memoPerClosure bool // o resultado depende das capturas: cada closure tem sua cache
+	captures       []capture
+	captureNames   map[string]int
+	ownerSlot      int // slot do let dono da função no escopo pai
+	selfCapture    int // captura que aponta para a própria closure
+
+	// lets ainda não construídos, por nome, do bloco mais interno para o
+	// último, e os slots que funções internas capturaram antes do let
+	forward map[string][]forwardLet
+	cells   map[int]bool
+
+	// funções conhecidas em tempo de build, por slot local e por captura
+	functions         map[int]*ScopeBuilder
+	capturedFunctions map[int]*ScopeBuilder
+
+	pool []*ScopeInstance
+}
+
+// Declare reserva um novo slot no frame
+func (self *ScopeBuilder) Declare() int {
+	defer func() { self.seq++ }()
+	return self.seq
 }
 
+// Register reserva um novo slot no frame e torna name visível a partir dele
 func (self *ScopeBuilder) Register(name string) int {
-	if index, has := self.indexes[name]; has {
-		return index
+	index := self.Declare()
+	self.names[name] = index
+	return index
+}
+
+// Bind torna name visível apontando para index e devolve quem desfaz o bind
+func (self *ScopeBuilder) Bind(name string, index int) func() {
+	prev, had := self.names[name]
+	self.names[name] = index
+	return func() {
+		if had {
+			self.names[name] = prev
+		} else {
+			delete(self.names, name)
+		}
+	}
+}
+
+// Forward reserva slots para os lets de um bloco ainda não construídos.
+// Uma função interna que usa um desses nomes, sem outro binding visível,
+// lê o slot através de uma cell: o let pode ser definido depois da função
+// (recursão mútua) ou ser o próprio let cujo valor cria a função.
+func (self *ScopeBuilder) Forward(chain int, names []string) {
+	if self.forward == nil {
+		self.forward = map[string][]forwardLet{}
+	}
+	for _, name := range names {
+		if list := self.forward[name]; len(list) == 0 || list[len(list)-1].chain != chain {
+			self.forward[name] = append(list, forwardLet{self.Declare(), chain})
+		}
+	}
+}
+
+// Claim retorna o slot reservado para o let name do bloco chain, que deixa
+// de ser uma referência adiantada depois que o valor do let é construído
+func (self *ScopeBuilder) Claim(name string, chain int) (slot int, release func(), ok bool) {
+	list := self.forward[name]
+	if len(list) == 0 || list[len(list)-1].chain != chain {
+		return 0, nil, false
+	}
+	return list[len(list)-1].slot, func() {
+		if len(list) == 1 {
+			delete(self.forward, name)
+		} else {
+			self.forward[name] = list[:len(list)-1]
+		}
+	}, true
+}
+
+// Resolve procura name nos slots locais e, se for livre, registra a
+// captura nos escopos envolventes
+func (self *ScopeBuilder) Resolve(name string) (index int, captured bool, found bool) {
+	index, captured, _, found = self.resolve(name, false)
+	if !found {
+		index, captured, _, found = self.resolve(name, true)
+	}
+	return
+}
+
+// resolve procura name primeiro entre os bindings; com forward, que só é
+// tentado quando nenhum binding existe, procura entre os lets reservados,
+// a partir do escopo mais interno
+func (self *ScopeBuilder) resolve(name string, forward bool) (index int, captured bool, cell bool, found bool) {
+	if i, h := self.names[name]; h && !forward {
+		return i, false, false, true
+	}
+	if i, h := self.captureNames[name]; h {
+		return i, true, self.captures[i].cell, true
+	}
+	if self.parent == nil {
+		return 0, false, false, false
+	}
+	var i int
+	var c bool
+	if list := self.parent.forward[name]; forward && len(list) > 0 {
+		// só funções internas enxergam um let reservado do escopo pai
+		i, cell, found = list[len(list)-1].slot, true, true
+		if self.parent.cells == nil {
+			self.parent.cells = map[int]bool{}
+		}
+		self.parent.cells[i] = true
 	} else {
-		self.indexes[name] = self.seq
-		defer func() { self.seq++ }()
-		return self.seq
+		i, c, cell, found = self.parent.resolve(name, forward)
+	}
+	if !found {
+		return 0, false, false, false
 	}
+	index = len(self.captures)
+	self.captures = append(self.captures, capture{local: !c, index: i, cell: cell})
+	self.captureNames[name] = index
+	if !c && i == self.ownerSlot {
+		self.selfCapture = index
+	}
+	if fn := self.parent.staticFunction(i, c); fn != nil {
+		self.capturedFunctions[index] = fn
+	}
+	return index, true, cell, true
+}
+
+// StaticFunction retorna a função que name sempre referencia no ponto
+// atual do build, ou nil se ela só é conhecida em runtime. Slots de let
+// nunca são reatribuídos, então um let ligado a uma função literal
+// sempre contém uma closure dela.
+func (self *ScopeBuilder) StaticFunction(name string) *ScopeBuilder {
+	if i, h := self.names[name]; h {
+		return self.staticFunction(i, false)
+	}
+	if i, h := self.captureNames[name]; h {
+		return self.staticFunction(i, true)
+	}
+	return nil
+}
+
+func (self *ScopeBuilder) staticFunction(index int, captured bool) *ScopeBuilder {
+	if captured {
+		return self.capturedFunctions[index]
+	}
+	return self.functions[index]
 }
 
 func (self *ScopeBuilder) New() *ScopeInstance {
-	return &ScopeInstance{builder: self, data: make([]interface{}, self.seq)}
+	return &ScopeInstance{data: make([]Value, self.seq)}
 }
 
-func newScopeBuilder() *ScopeBuilder {
-	return &ScopeBuilder{indexes: map[string]int{}}
+// Frame retorna um frame de chamada da closure, reaproveitando um frame
+// liberado quando houver
+func (self *ScopeBuilder) Frame(closure *Closure) *ScopeInstance {
+	if n := len(self.pool); n > 0 {
+		frame := self.pool[n-1]
+		self.pool = self.pool[:n-1]
+		frame.closure = closure
+		return frame
+	}
+	return &ScopeInstance{closure: closure, data: make([]Value, self.seq)}
+}
+
+// Release devolve o frame ao pool. Closures copiam o que capturam, então
+// nenhum frame sobrevive à chamada que o criou
+func (self *ScopeBuilder) Release(frame *ScopeInstance) {
+	if len(self.pool) == FramePoolLimit {
+		return
+	}
+	clear(frame.data)
+	frame.closure = nil
+	self.pool = append(self.pool, frame)
+}
+
+func newScopeBuilder(parent *ScopeBuilder) *ScopeBuilder {
+	return &ScopeBuilder{
+		parent:            parent,
+		names:             map[string]int{},
+		captureNames:      map[string]int{},
+		functions:         map[int]*ScopeBuilder{},
+		capturedFunctions: map[int]*ScopeBuilder{},
+		cells:             map[int]bool{},
+		ownerSlot:         -1,
+		selfCapture:       -1,
+	}
 }
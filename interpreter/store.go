@@ -0,0 +1,255 @@
+package interpreter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// O memo store guarda em disco os resultados das funções memoizadas, para
+// reaproveitá-los na próxima execução. O arquivo só recebe linhas novas:
+//
+//	rinha-memo 2
+//	<fingerprint> <chave> <valor>
+//
+// chave e valor usam a codificação de appendMemoKey, entre aspas. O
+// fingerprint é um hash do corpo da função, do let do root que a contém, dos
+// lets do root definidos antes dele (que é tudo o que ela pode capturar ou
+// chamar) e do modo de inteiros, então resultados de uma versão antiga da
+// função são ignorados.
+
+const memoStoreHeader = "rinha-memo 2"
+
+type memoStore struct {
+	file    *os.File
+	w       *bufio.Writer
+	records map[string]map[string]string // fingerprint -> chave -> valor
+	prefix  hash.Hash                    // lets do root vistos até agora
+}
+
+func openMemoStore(path string, intMode IntMode) (*memoStore, error) {
+	self := &memoStore{records: map[string]map[string]string{}, prefix: sha256.New()}
+	fmt.Fprintf(self.prefix, "%s;", intMode)
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if !strings.HasPrefix(string(b), memoStoreHeader+"\n") {
+			return nil, fmt.Errorf("%s is not a memo store", path)
+		}
+		lines := strings.Split(string(b), "\n")
+		// uma última linha sem \n foi interrompida no meio: é descartada
+		for _, line := range lines[1 : len(lines)-1] {
+			fingerprint, key, value, ok := parseMemoRecord(line)
+			if !ok {
+				continue
+			}
+			if self.records[fingerprint] == nil {
+				self.records[fingerprint] = map[string]string{}
+			}
+			self.records[fingerprint][key] = value
+		}
+	}
+
+	if self.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	self.w = bufio.NewWriter(self.file)
+	if len(b) == 0 {
+		self.w.WriteString(memoStoreHeader + "\n")
+	} else if b[len(b)-1] != '\n' {
+		self.w.WriteString("\n")
+	}
+	return self, nil
+}
+
+func parseMemoRecord(line string) (fingerprint, key, value string, ok bool) {
+	fingerprint, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return
+	}
+	quoted, err := strconv.QuotedPrefix(rest)
+	if err != nil || len(rest) == len(quoted) || rest[len(quoted)] != ' ' {
+		return "", "", "", false
+	}
+	key, _ = strconv.Unquote(quoted)
+	value, err = strconv.Unquote(rest[len(quoted)+1:])
+	return fingerprint, key, value, err == nil
+}
+
+// define registra um let do root; chamado na ordem do código
+func (self *memoStore) define(name string, value map[string]interface{}) {
+	fmt.Fprintf(self.prefix, "let %s=", name)
+	writeCanonical(self.prefix, value)
+}
+
+func (self *memoStore) fingerprint(function, enclosing map[string]interface{}) string {
+	h := sha256.New()
+	h.Write(self.prefix.Sum(nil))
+	writeCanonical(h, function)
+	if enclosing != nil {
+		writeCanonical(h, enclosing)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (self *memoStore) write(fingerprint, key, value string) {
+	fmt.Fprintf(self.w, "%s %s %s\n", fingerprint, strconv.Quote(key), strconv.Quote(value))
+}
+
+func (self *memoStore) Close() error {
+	err := self.w.Flush()
+	if cerr := self.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeCanonical escreve um nó da AST sem localizações, anotações e
+// diretivas, com os campos em ordem, para que o hash dependa só do que
+// define o resultado
+func writeCanonical(h hash.Hash, node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			if k != "location" && k != "effect" && k != "memo" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		h.Write([]byte{'{'})
+		for _, k := range keys {
+			fmt.Fprintf(h, "%q:", k)
+			writeCanonical(h, n[k])
+		}
+		h.Write([]byte{'}'})
+	case []interface{}:
+		h.Write([]byte{'['})
+		for _, item := range n {
+			writeCanonical(h, item)
+		}
+		h.Write([]byte{']'})
+	case string:
+		fmt.Fprintf(h, "%q;", n)
+	default:
+		fmt.Fprintf(h, "%v;", n)
+	}
+}
+
+// storable indica se os valores podem ir para o disco: closures só têm
+// identidade dentro de uma execução
+func storable(values ...Value) bool {
+	for _, v := range values {
+		if hasClosure(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeMemoValue lê um valor codificado por appendMemoKey
+func decodeMemoValue(s string) (Value, error) {
+	v, rest, err := decodeMemoPrefix(s)
+	if err == nil && rest != "" {
+		err = errors.New("trailing data")
+	}
+	return v, err
+}
+
+func decodeMemoPrefix(s string) (v Value, rest string, err error) {
+	if s == "" {
+		return Value{}, "", errors.New("unexpected end of value")
+	}
+	tag, s := s[0], s[1:]
+	if tag == 't' {
+		first, s, err := decodeMemoPrefix(s)
+		if err != nil {
+			return Value{}, "", err
+		}
+		second, s, err := decodeMemoPrefix(s)
+		return NewTuple(first, second), s, err
+	}
+	if tag == 's' {
+		n, after, ok := strings.Cut(s, ":")
+		size, err := strconv.Atoi(n)
+		if !ok || err != nil || size < 0 || len(after) <= size || after[size] != ';' {
+			return Value{}, "", errors.New("invalid string")
+		}
+		return Str(after[:size]), after[size+1:], nil
+	}
+
+	text, rest, ok := strings.Cut(s, ";")
+	if !ok {
+		return Value{}, "", errors.New("unexpected end of value")
+	}
+	switch tag {
+	case 'i':
+		i, err := strconv.ParseInt(text, 10, 64)
+		return Int(i), rest, err
+	case 'I':
+		b, ok := new(big.Int).SetString(text, 16)
+		if !ok {
+			return Value{}, "", errors.New("invalid bigint")
+		}
+		return BigInt(b), rest, nil
+	case 'f':
+		bits, err := strconv.ParseUint(text, 16, 64)
+		return Float(math.Float64frombits(bits)), rest, err
+	case 'b':
+		return Bool(text == "1"), rest, nil
+	}
+	return Value{}, "", fmt.Errorf("unknown value tag %q", tag)
+}
+
+// ------------------- integração com a cache
+
+// attach liga a cache de uma função aos resultados gravados para ela.
+// enclosing é o valor do let do root que contém a função: uma função
+// interna pode chamar a externa, que ainda não foi definida no store.
+func (self *memoStore) attach(m *Memoize, function, enclosing map[string]interface{}) {
+	m.store = self
+	m.fingerprint = self.fingerprint(function, enclosing)
+	m.stored = self.records[m.fingerprint]
+}
+
+// load procura no store um resultado que não está na cache
+func (self *Memoize) load(key string) (Value, bool) {
+	encoded, ok := self.stored[key]
+	if !ok {
+		return Value{}, false
+	}
+	v, err := decodeMemoValue(encoded)
+	if err != nil {
+		delete(self.stored, key)
+		return Value{}, false
+	}
+	self.loaded++
+	return v, true
+}
+
+func (self *Memoize) save(key string, v Value) {
+	if self.stored == nil {
+		self.stored = map[string]string{}
+		self.store.records[self.fingerprint] = self.stored
+	}
+	if _, ok := self.stored[key]; ok {
+		return
+	}
+	value, ok := appendMemoKey(nil, []Value{v})
+	if ok && storable(v) {
+		self.stored[key] = string(value)
+		self.store.write(self.fingerprint, key, string(value))
+	}
+}
@@ -0,0 +1,124 @@
+package interpreter
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// runStored executa src com o store em path e retorna o resultado e quantos
+// resultados foram lidos do disco
+func runStored(t *testing.T, src, path string, mode IntMode) (Value, int) {
+	t.Helper()
+	ast, err := Parse("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats strings.Builder
+	v := BuildAst(src, ast, Options{IntMode: mode, Memo: MemoOptions{Store: path, Stats: &stats}})()
+	loaded := 0
+	for _, line := range strings.Split(strings.TrimRight(stats.String(), "\n"), "\n")[1:] {
+		n, _ := strconv.Atoi(strings.Fields(line)[4])
+		loaded += n
+	}
+	return v, loaded
+}
+
+func TestMemoStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memo")
+	fib := "let fib = fn (n) => if (n < 2) { n } else { fib(n - 1) + fib(n - 2) };\n"
+
+	if v, loaded := runStored(t, fib+"fib(100)", path, IntModeBigInt); v.String() != "354224848179261915075" || loaded != 0 {
+		t.Fatalf("first run: %s, %d loaded", v, loaded)
+	}
+	// fib(101) usa fib(100) e fib(99) do disco
+	if v, loaded := runStored(t, fib+"fib(101)", path, IntModeBigInt); v.String() != "573147844013817084101" || loaded != 2 {
+		t.Errorf("second run: %s, %d loaded", v, loaded)
+	}
+
+	// outro corpo, outro let antes da função ou outro modo de inteiros
+	// invalidam os resultados gravados
+	stale := []struct {
+		src  string
+		mode IntMode
+	}{
+		{"let fib = fn (n) => if (n < 2) { 1 } else { fib(n - 1) + fib(n - 2) };\nfib(30)", IntModeBigInt},
+		{"let one = 1;\n" + fib + "fib(30)", IntModeBigInt},
+		{fib + "fib(30)", IntModeI64Wrap},
+	}
+	for _, tt := range stale {
+		if _, loaded := runStored(t, tt.src, path, tt.mode); loaded != 0 {
+			t.Errorf("%s (%s): %d stale results loaded", tt.src, tt.mode, loaded)
+		}
+	}
+	if v, loaded := runStored(t, "let one = 1;\n"+fib+"fib(31)", path, IntModeBigInt); v.String() != "1346269" || loaded != 2 {
+		t.Errorf("%s, %d loaded", v, loaded)
+	}
+
+	// uma função interna depende da função do root que a contém
+	nested := filepath.Join(t.TempDir(), "memo")
+	outer := "let outer = fn (x) => { let inner = fn (y) => if (y == 0) { 0 } else { outer(y - 1) + 1 }; inner(x) };\n"
+	runStored(t, outer+"outer(3)", nested, IntModeBigInt)
+	edited := strings.Replace(outer, "inner(x) }", "inner(x) * 10 }", 1)
+	if v, loaded := runStored(t, edited+"outer(3)", nested, IntModeBigInt); v.String() != "1110" || loaded != 0 {
+		t.Errorf("edited outer function: %s, %d loaded", v, loaded)
+	}
+	if v, loaded := runStored(t, outer+"outer(4)", nested, IntModeBigInt); v.String() != "4" || loaded != 1 {
+		t.Errorf("unchanged outer function: %s, %d loaded", v, loaded)
+	}
+
+	// uma gravação interrompida no meio é ignorada
+	b, _ := os.ReadFile(path)
+	os.WriteFile(path, append(b, "abc \"i1;"...), 0o644)
+	if v, loaded := runStored(t, fib+"fib(101)", path, IntModeBigInt); v.String() != "573147844013817084101" || loaded != 1 {
+		t.Errorf("after a partial record: %s, %d loaded", v, loaded)
+	}
+	if v, loaded := runStored(t, fib+"fib(102)", path, IntModeBigInt); v.String() != "927372692193078999176" || loaded != 2 {
+		t.Errorf("after a partial record: %s, %d loaded", v, loaded)
+	}
+}
+
+func TestMemoStoreValues(t *testing.T) {
+	values := []Value{
+		Int(-7), bigValue("-123456789012345678901234567890"), Float(math.Copysign(0, -1)), Float(1.5),
+		Bool(true), Bool(false), Str(""), Str("a;b:c\n\"d\""),
+		NewTuple(Int(1), NewTuple(Str("x"), NewTuple(Bool(true), Float(2)))),
+		NewTuple(NewTuple(Int(1), Int(2)), Int(3)),
+	}
+	for _, v := range values {
+		key, _ := appendMemoKey(nil, []Value{v})
+		got, err := decodeMemoValue(string(key))
+		if err != nil {
+			t.Errorf("%s: %v", v, err)
+			continue
+		}
+		if c, _, ok := compareValues(v, got, false); !ok || c != 0 || got.kind != v.kind {
+			t.Errorf("%s decoded as %s", v, got)
+		}
+	}
+	for _, bad := range []string{"", "i1", "x1;", "s3:ab;", "ti1;", "i1;i2;"} {
+		if _, err := decodeMemoValue(bad); err == nil {
+			t.Errorf("%q decoded", bad)
+		}
+	}
+
+	// closures só existem dentro de uma execução
+	path := filepath.Join(t.TempDir(), "memo")
+	src := "let id = fn (x) => x;\nlet f = fn (g, n) => if (n == 0) { (g, 0) } else { (g, n) };\nlet _ = f(id, 1);\nf(1, 2)"
+	runStored(t, src, path, IntModeBigInt)
+	if b, _ := os.ReadFile(path); strings.Count(string(b), "\n") != 2 {
+		t.Errorf("closures stored:\n%s", b)
+	}
+
+	// checar os argumentos não pode alterar o frame da chamada
+	path = filepath.Join(t.TempDir(), "memo")
+	src = "let f = fn (p) => { let a = 1; let b = 2; first(p) + first(second(p)) + second(second(p)) + a + b };\nf((10, (20, 30)))"
+	for i, loaded := range []int{0, 1} {
+		if v, n := runStored(t, src, path, IntModeBigInt); v.String() != "63" || n != loaded {
+			t.Errorf("run %d: %s, %d loaded", i+1, v, n)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package interpreter
+
+import (
+	"fmt"
+)
+
+// ValidationError aponta o nó da AST com estrutura inválida
+type ValidationError struct {
+	Message  string
+	Location map[string]interface{}
+}
+
+func (self *ValidationError) Error() string {
+	return "Invalid AST: " + self.Message
+}
+
+var binaryOps = map[string]bool{
+	"Add": true, "Sub": true, "Mul": true, "Div": true, "Rem": true,
+	"Eq": true, "Neq": true, "Lt": true, "Gt": true, "Lte": true, "Gte": true,
+	"And": true, "Or": true,
+}
+
+var unaryOps = map[string]bool{"Neg": true, "Not": true}
+
+// campos de cada tipo de nó: "term" é um nó, "[]term" uma lista de nós,
+// "name" um {text} e "[]name" uma lista deles
+var nodeFields = map[string][][2]string{
+	"Int":      {{"value", "number"}},
+	"Float":    {{"value", "number"}},
+	"Str":      {{"value", "string"}},
+	"Bool":     {{"value", "bool"}},
+	"Var":      {{"text", "string"}},
+	"Let":      {{"name", "name"}, {"value", "term"}, {"next", "term"}},
+	"Function": {{"parameters", "[]name"}, {"value", "term"}},
+	"Call":     {{"callee", "term"}, {"arguments", "[]term"}},
+	"If":       {{"condition", "term"}, {"then", "term"}, {"otherwise", "term"}},
+	"Binary":   {{"op", "string"}, {"lhs", "term"}, {"rhs", "term"}},
+	"Unary":    {{"op", "string"}, {"value", "term"}},
+	"Tuple":    {{"first", "term"}, {"second", "term"}},
+	"First":    {{"value", "term"}},
+	"Second":   {{"value", "term"}},
+	"Print":    {{"value", "term"}},
+}
+
+// Validate confere a estrutura da AST antes do build, para que um json
+// malformado seja reportado com a localização do nó em vez de falhar
+// durante a execução
+func Validate(ast map[string]interface{}) error {
+	exp, ok := ast["expression"].(map[string]interface{})
+	if !ok {
+		return &ValidationError{Message: "missing expression"}
+	}
+	return validateTerm(exp)
+}
+
+func validateTerm(term map[string]interface{}) error {
+	loc, _ := term["location"].(map[string]interface{})
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Message: fmt.Sprintf(format, args...), Location: loc}
+	}
+
+	kind, _ := term["kind"].(string)
+	fields, ok := nodeFields[kind]
+	if !ok {
+		return fail("unknown node kind %q", term["kind"])
+	}
+	for _, f := range fields {
+		name, typ := f[0], f[1]
+		v, present := term[name]
+		if !present {
+			return fail("%s node without '%s'", kind, name)
+		}
+		if !isFieldType(v, typ) {
+			return fail("%s node with invalid '%s'", kind, name)
+		}
+		if err := validateField(v, typ); err != nil {
+			return err
+		}
+	}
+
+	switch kind {
+	case "Binary":
+		if !binaryOps[term["op"].(string)] {
+			return fail("unknown binary operator %q", term["op"])
+		}
+	case "Unary":
+		if !unaryOps[term["op"].(string)] {
+			return fail("unknown unary operator %q", term["op"])
+		}
+	case "Function":
+		// diretiva opcional: {"enabled": bool, "limit": número}
+		if memo, present := term["memo"]; present {
+			m, ok := memo.(map[string]interface{})
+			if ok {
+				_, ok = m["enabled"].(bool)
+			}
+			if limit, present := m["limit"]; ok && present {
+				ok = isFieldType(limit, "number") && intLiteral(limit) > 0
+			}
+			if !ok {
+				return fail("Function node with invalid 'memo'")
+			}
+		}
+	}
+	return nil
+}
+
+func isFieldType(v interface{}, typ string) bool {
+	switch typ {
+	case "number":
+		switch v.(type) {
+		case float64, int64:
+			return true
+		}
+		return false
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "term":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "name":
+		n, ok := v.(map[string]interface{})
+		if ok {
+			_, ok = n["text"].(string)
+		}
+		return ok
+	}
+	// listas
+	list, ok := v.([]interface{})
+	for i := 0; ok && i < len(list); i++ {
+		ok = isFieldType(list[i], typ[2:])
+	}
+	return ok
+}
+
+// validateField desce nos nós filhos de um campo
+func validateField(v interface{}, typ string) error {
+	switch typ {
+	case "term":
+		return validateTerm(v.(map[string]interface{}))
+	case "[]term":
+		for _, item := range v.([]interface{}) {
+			if err := validateTerm(item.(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
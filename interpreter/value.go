@@ -0,0 +1,199 @@
+package interpreter
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type Kind uint8
+
+const (
+	KindNone Kind = iota // slot ainda não atribuído
+	KindInt
+	KindBool
+	KindStr
+	KindBigInt
+	KindTuple
+	KindClosure
+	KindFloat
+)
+
+// Value é um valor da linguagem sem boxing: int, bool e float ficam em num,
+// e apenas string, bigint, tupla e closure usam o ponteiro ref (além da
+// cell de um let capturado antes de ser atribuído, que tem kind KindNone).
+// Para strings, ref aponta para os bytes e num guarda o tamanho.
+type Value struct {
+	kind Kind
+	num  int64
+	ref  unsafe.Pointer
+}
+
+type Tuple [2]Value
+
+func Int(i int64) Value {
+	return Value{kind: KindInt, num: i}
+}
+
+func Bool(b bool) Value {
+	if b {
+		return Value{kind: KindBool, num: 1}
+	}
+	return Value{kind: KindBool}
+}
+
+func Float(f float64) Value {
+	return Value{kind: KindFloat, num: int64(math.Float64bits(f))}
+}
+
+func Str(s string) Value {
+	return Value{kind: KindStr, num: int64(len(s)), ref: unsafe.Pointer(unsafe.StringData(s))}
+}
+
+// BigInt normaliza o valor: inteiros que cabem em int64 nunca ficam como
+// bigint, então cada número tem uma única representação
+func BigInt(b *big.Int) Value {
+	if b.IsInt64() {
+		return Int(b.Int64())
+	}
+	return Value{kind: KindBigInt, ref: unsafe.Pointer(b)}
+}
+
+func NewTuple(first, second Value) Value {
+	return Value{kind: KindTuple, ref: unsafe.Pointer(&Tuple{first, second})}
+}
+
+func closureValue(c *Closure) Value {
+	return Value{kind: KindClosure, ref: unsafe.Pointer(c)}
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+func (v Value) IsNone() bool {
+	return v.kind == KindNone
+}
+
+func (v Value) Int() int64 {
+	return v.num
+}
+
+func (v Value) Bool() bool {
+	return v.num != 0
+}
+
+func (v Value) Float() float64 {
+	return math.Float64frombits(uint64(v.num))
+}
+
+func (v Value) Str() string {
+	return unsafe.String((*byte)(v.ref), int(v.num))
+}
+
+func (v Value) Big() *big.Int {
+	return (*big.Int)(v.ref)
+}
+
+func (v Value) Tuple() *Tuple {
+	return (*Tuple)(v.ref)
+}
+
+func (v Value) Closure() *Closure {
+	return (*Closure)(v.ref)
+}
+
+// toBig converte int ou bigint para *big.Int
+func (v Value) toBig() *big.Int {
+	if v.kind == KindBigInt {
+		return v.Big()
+	}
+	return big.NewInt(v.num)
+}
+
+func (v Value) String() string {
+	if v.kind == KindTuple {
+		return PrintOptions{}.Format(v)
+	}
+	return v.scalarString()
+}
+
+func (v Value) scalarString() string {
+	switch v.kind {
+	case KindInt:
+		return strconv.FormatInt(v.num, 10)
+	case KindBool:
+		return strconv.FormatBool(v.Bool())
+	case KindStr:
+		return v.Str()
+	case KindBigInt:
+		return v.Big().String()
+	case KindFloat:
+		return formatFloat(v.Float())
+	case KindClosure:
+		return "<#closure>"
+	}
+	return "<none>"
+}
+
+// formatFloat sempre mostra que o número é float: 2.0 e não 2
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// compareInts compara dois valores inteiros (int64 ou bigint). Como um
+// bigint nunca cabe em int64, comparar com um int64 só depende do sinal.
+func compareInts(l, r Value) int {
+	switch {
+	case l.kind == KindInt && r.kind == KindInt:
+		return cmp.Compare(l.num, r.num)
+	case l.kind == KindInt:
+		return -r.Big().Sign()
+	case r.kind == KindInt:
+		return l.Big().Sign()
+	}
+	return l.Big().Cmp(r.Big())
+}
+
+// compareValues compara l e r estruturalmente: números pelo valor (int,
+// bigint e float se misturam), strings e tuplas em ordem lexicográfica.
+// Sem ordered o resultado só distingue igual (0) de diferente, e aceita
+// também bools e closures, que são iguais apenas se forem a mesma
+// instância. Para tipos que não se comparam, ok é false e bad indica o par
+// responsável, que pode estar dentro de uma tupla. Um NaN torna o resultado
+// unordered, inclusive dentro de tuplas.
+func compareValues(l, r Value, ordered bool) (c int, bad [2]Kind, ok bool) {
+	for {
+		switch {
+		case isNumber(l) && isNumber(r):
+			return compareNumbers(l, r), bad, true
+		case l.kind != r.kind:
+		case l.kind == KindStr:
+			return strings.Compare(l.Str(), r.Str()), bad, true
+		case l.kind == KindBool && !ordered:
+			return cmp.Compare(l.num, r.num), bad, true
+		case l.kind == KindClosure && !ordered:
+			if l.ref == r.ref {
+				return 0, bad, true
+			}
+			return 1, bad, true
+		case l.kind == KindTuple:
+			lt, rt := l.Tuple(), r.Tuple()
+			if c, bad, ok = compareValues(lt[0], rt[0], ordered); !ok || c != 0 {
+				return
+			}
+			// o segundo elemento é comparado no laço, sem recursão, para
+			// suportar listas longas encadeadas em tuplas
+			l, r = lt[1], rt[1]
+			continue
+		}
+		return 0, [2]Kind{l.kind, r.kind}, false
+	}
+}
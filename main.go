@@ -2,21 +2,51 @@ package main
 
 import (
 	"altairspankbs/interpreter"
+	"flag"
 	"fmt"
 	"os"
 	"time"
 )
 
 func main() {
+	var opts interpreter.Options
+	intMode := flag.String("int-mode", "bigint", "integer model: i32, i64-wrap, i64-checked or bigint")
+	flag.IntVar(&opts.Print.MaxDepth, "print-depth", 0, "maximum tuple depth shown by print (0 = unlimited)")
+	flag.IntVar(&opts.Print.MaxElements, "print-elements", 0, "maximum values shown by print (0 = unlimited)")
+	flag.IntVar(&opts.Print.BigIntDigits, "print-bigint-digits", 0, "abbreviate bigints longer than this (0 = all digits)")
+	flag.BoolVar(&opts.Print.Pretty, "print-pretty", false, "print tuples on multiple lines")
+	memo := flag.String("memo", "lru", "memoization policy: lru, lfu, unbounded or off")
+	flag.IntVar(&opts.Memo.MaxEntries, "memo-entries", interpreter.MemoizeCacheLimit, "memo cache entries per function")
+	flag.IntVar(&opts.Memo.ProgramEntries, "memo-program-entries", 0, "memo cache entries for the whole program (0 = unlimited)")
+	flag.Int64Var(&opts.Memo.MaxBytes, "memo-bytes", 0, "estimated memo cache memory for the whole program, in bytes (0 = unlimited)")
+	flag.IntVar(&opts.Memo.MissLimit, "memo-miss-limit", 0, "disable a full memo cache after this many lookups in a row without a hit (default 0 = never: with eviction a full cache still gets hits later)")
+	flag.StringVar(&opts.Memo.Store, "memo-store", "", "file where memo results are kept between runs")
+	memoStats := flag.Bool("memo-stats", false, "print memo cache statistics per function to stderr")
+	flag.Parse()
+
+	var err error
+	if opts.IntMode, err = interpreter.ParseIntMode(*intMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if opts.Memo.Policy, err = interpreter.ParseMemoPolicy(*memo); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *memoStats {
+		opts.Memo.Stats = os.Stderr
+	}
+
+	args := flag.Args()
 	var file string
-	if len(os.Args) == 1 {
+	if len(args) == 0 {
 		file = "/var/rinha/source.rinha.json"
 	} else {
-		file = os.Args[1]
+		file = args[0]
 	}
 
-	program := interpreter.Build(file)
-	if os.Args[len(os.Args)-1] == "time" {
+	program := interpreter.BuildWithOptions(file, opts)
+	if len(args) > 0 && args[len(args)-1] == "time" {
 		t := time.Now()
 		program()
 		fmt.Printf("\ntime: %f secs\n\n", time.Now().Sub(t).Seconds())